@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	MethodToken = "token"
+	MethodCert  = "cert"
+)
+
+// Principal is the authenticated identity behind a request.
+type Principal struct {
+	Name   string
+	Groups []string
+	Method string
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+type Token struct {
+	Token  string
+	Name   string
+	Groups []string
+}
+
+func LoadTokens(path string) ([]Token, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tokens: %w", err)
+	}
+
+	var tokens []Token
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("error decoding tokens: %w", err)
+	}
+
+	for _, t := range tokens {
+		if t.Token == "" || t.Name == "" {
+			return nil, fmt.Errorf("token must have a value and a name")
+		}
+	}
+
+	return tokens, nil
+}
+
+// Authenticator accepts requests carrying a known bearer token or a client
+// certificate verified by the server's TLS config.
+type Authenticator struct {
+	Logger *log.Logger
+
+	tokens map[[sha256.Size]byte]Principal
+}
+
+func NewAuthenticator(l *log.Logger, tokens []Token) (*Authenticator, error) {
+	a := &Authenticator{
+		Logger: l,
+		tokens: make(map[[sha256.Size]byte]Principal),
+	}
+	for _, t := range tokens {
+		a.tokens[sha256.Sum256([]byte(t.Token))] = Principal{
+			Name:   t.Name,
+			Groups: t.Groups,
+			Method: MethodToken,
+		}
+	}
+	return a, a.validate()
+}
+
+func (a *Authenticator) validate() error {
+	if a.Logger == nil {
+		return fmt.Errorf("logger is nil")
+	}
+	return nil
+}
+
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, bool) {
+	if h := r.Header.Get("Authorization"); h != "" {
+		scheme, token, ok := strings.Cut(h, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return Principal{}, false
+		}
+		return a.lookupToken(strings.TrimSpace(token))
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		return Principal{
+			Name:   cert.Subject.CommonName,
+			Groups: cert.Subject.Organization,
+			Method: MethodCert,
+		}, true
+	}
+
+	return Principal{}, false
+}
+
+func (a *Authenticator) lookupToken(token string) (Principal, bool) {
+	sum := sha256.Sum256([]byte(token))
+	for k, p := range a.tokens {
+		if subtle.ConstantTimeCompare(k[:], sum[:]) == 1 {
+			return p, true
+		}
+	}
+	return Principal{}, false
+}
+
+// Middleware rejects unauthenticated requests with 401 and stores the
+// principal of the others in the request context.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := a.Authenticate(r)
+		if !ok {
+			a.Logger.Printf("unauthenticated request %s %s from %s\n", r.Method, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cube"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(errorResponse{
+				HTTPStatusCode: http.StatusUnauthorized,
+				Message:        "authentication required",
+			})
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+// RequireGroup returns middleware that lets through only requests whose
+// principal, set by Middleware, is in group, and rejects the others with 403.
+func (a *Authenticator) RequireGroup(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := PrincipalFrom(r.Context())
+			if !ok || !slices.Contains(p.Groups, group) {
+				a.Logger.Printf("forbidden request %s %s from %s by %q, not in group %s\n", r.Method, r.URL.Path, r.RemoteAddr, p.Name, group)
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(errorResponse{
+					HTTPStatusCode: http.StatusForbidden,
+					Message:        fmt.Sprintf("forbidden: %s is not in group %s", p.Name, group),
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type errorResponse struct {
+	HTTPStatusCode int
+	Message        string
+}
+
+// TokenTransport adds a bearer token to every outgoing request.
+type TokenTransport struct {
+	Token string
+	Base  http.RoundTripper
+}
+
+func (t *TokenTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t.Token == "" {
+		return base.RoundTrip(r)
+	}
+
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.Token)
+	return base.RoundTrip(r)
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testAuthenticator(t *testing.T, tokens ...Token) *Authenticator {
+	t.Helper()
+	a, err := NewAuthenticator(log.New(io.Discard, "", 0), tokens)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v", err)
+	}
+	return a
+}
+
+func TestRequireGroup(t *testing.T) {
+	a := testAuthenticator(t,
+		Token{Token: "manager-token", Name: "manager", Groups: []string{GroupManagers}},
+		Token{Token: "worker-token", Name: "w2:5555", Groups: []string{GroupWorkers}},
+		Token{Token: "user-token", Name: "alice"},
+	)
+	h := a.Middleware(a.RequireGroup(GroupManagers)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "manager", token: "manager-token", want: http.StatusNoContent},
+		{name: "another worker", token: "worker-token", want: http.StatusForbidden},
+		{name: "user", token: "user-token", want: http.StatusForbidden},
+		{name: "unknown token", token: "nope", want: http.StatusUnauthorized},
+		{name: "no token", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodDelete, "/tasks/1", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+// whoami answers with the principal of the request.
+func whoami(w http.ResponseWriter, r *http.Request) {
+	p, _ := PrincipalFrom(r.Context())
+	json.NewEncoder(w).Encode(p)
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	a := testAuthenticator(t, Token{Token: "s3cret", Name: "alice", Groups: []string{"ops"}})
+	h := a.Middleware(http.HandlerFunc(whoami))
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{name: "valid token", header: "Bearer s3cret", want: http.StatusOK},
+		{name: "scheme is case insensitive", header: "bearer s3cret", want: http.StatusOK},
+		{name: "unknown token", header: "Bearer s3cret2", want: http.StatusUnauthorized},
+		{name: "basic auth", header: "Basic YWxpY2U6czNjcmV0", want: http.StatusUnauthorized},
+		{name: "missing token", header: "Bearer", want: http.StatusUnauthorized},
+		{name: "no credentials", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/tasks", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				if rec.Header().Get("WWW-Authenticate") == "" {
+					t.Errorf("no WWW-Authenticate header on a 401")
+				}
+				return
+			}
+
+			var p Principal
+			json.NewDecoder(rec.Body).Decode(&p)
+			if p.Name != "alice" || p.Method != MethodToken || !slices.Equal(p.Groups, []string{"ops"}) {
+				t.Errorf("principal = %+v", p)
+			}
+		})
+	}
+}
+
+func TestAuthenticateCert(t *testing.T) {
+	dir := t.TempDir()
+	ca, _, err := NewCA("test-ca")
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	other, _, err := NewCA("other-ca")
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+
+	write := func(name string, ca *CA, cn string, groups []string) (string, string) {
+		certPEM, keyPEM, err := ca.Issue(cn, groups, []string{"127.0.0.1"})
+		if err != nil {
+			t.Fatalf("Issue: %v", err)
+		}
+		certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+		if err := WriteKeyPair(certFile, keyFile, certPEM, keyPEM); err != nil {
+			t.Fatalf("WriteKeyPair: %v", err)
+		}
+		return certFile, keyFile
+	}
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := writeAtomic(caFile, ca.CertPEM, 0644); err != nil {
+		t.Fatalf("writing ca: %v", err)
+	}
+
+	serverCert, serverKey := write("server", ca, "manager", nil)
+	cfg, err := ServerTLSConfig(serverCert, serverKey, caFile)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(testAuthenticator(t).Middleware(http.HandlerFunc(whoami)))
+	srv.Listener = tls.NewListener(srv.Listener, cfg)
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.Start()
+	defer srv.Close()
+	url := strings.Replace(srv.URL, "http://", "https://", 1)
+
+	workerCert, workerKey := write("worker", ca, "w1:5555", []string{GroupWorkers})
+	rogueCert, rogueKey := write("rogue", other, "w1:5555", []string{GroupWorkers})
+
+	tests := []struct {
+		name     string
+		certFile string
+		keyFile  string
+		want     int // 0 if the handshake fails
+	}{
+		{name: "certificate from the ca", certFile: workerCert, keyFile: workerKey, want: http.StatusOK},
+		{name: "no certificate", want: http.StatusUnauthorized},
+		{name: "certificate from another ca", certFile: rogueCert, keyFile: rogueKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientCfg, err := ClientTLSConfig(tt.certFile, tt.keyFile, caFile)
+			if err != nil {
+				t.Fatalf("ClientTLSConfig: %v", err)
+			}
+			c := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}
+
+			resp, err := c.Get(url)
+			if tt.want == 0 {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("request succeeded with status %d, want a handshake failure", resp.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var p Principal
+			json.NewDecoder(resp.Body).Decode(&p)
+			if p.Name != "w1:5555" || p.Method != MethodCert || !slices.Equal(p.Groups, []string{GroupWorkers}) {
+				t.Errorf("principal = %+v", p)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	defaultCAValidity   = 10 * 365 * 24 * time.Hour
+	defaultCertValidity = 30 * 24 * time.Hour
+)
+
+// CA is a lightweight certificate authority used to issue certificates to
+// the manager and to workers when they register.
+type CA struct {
+	Cert     *x509.Certificate
+	CertPEM  []byte
+	Validity time.Duration
+
+	key crypto.Signer
+}
+
+func NewCA(commonName string) (*CA, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(defaultCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &CA{
+		Cert:     cert,
+		CertPEM:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Validity: defaultCertValidity,
+		key:      key,
+	}, keyPEM, nil
+}
+
+func LoadCA(certFile, keyFile string) (*CA, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading ca: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("error parsing ca certificate: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("%s is not a ca certificate", certFile)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("ca key cannot sign")
+	}
+
+	return &CA{
+		Cert:     cert,
+		CertPEM:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		Validity: defaultCertValidity,
+		key:      key,
+	}, nil
+}
+
+// LoadOrCreateCA loads the CA from certFile and keyFile, creating both files
+// with a new CA if they do not exist yet.
+func LoadOrCreateCA(certFile, keyFile, commonName string) (*CA, error) {
+	if _, err := os.Stat(certFile); err == nil {
+		return LoadCA(certFile, keyFile)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	ca, keyPEM, err := NewCA(commonName)
+	if err != nil {
+		return nil, fmt.Errorf("error creating ca: %w", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return nil, fmt.Errorf("error writing ca key: %w", err)
+	}
+	if err := os.WriteFile(certFile, ca.CertPEM, 0644); err != nil {
+		return nil, fmt.Errorf("error writing ca certificate: %w", err)
+	}
+	return ca, nil
+}
+
+// SignCSR issues a certificate for the key in the PEM encoded certificate
+// request. The subject and hosts are set by the caller; only the key is taken
+// from the request. The certificate can be used both to serve TLS and to
+// authenticate as a client.
+func (ca *CA) SignCSR(csrPEM []byte, subject pkix.Name, hosts []string) ([]byte, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("no certificate request found")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate request: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+
+	return ca.sign(csr.PublicKey, subject, hosts)
+}
+
+// Issue creates a key and a certificate signed by the CA.
+func (ca *CA) Issue(commonName string, organization []string, hosts []string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM, err = ca.sign(key.Public(), pkix.Name{CommonName: commonName, Organization: organization}, hosts)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err = encodeKey(key)
+	return certPEM, keyPEM, err
+}
+
+func (ca *CA) sign(pub crypto.PublicKey, subject pkix.Name, hosts []string) ([]byte, error) {
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(ca.Validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, pub, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("error signing certificate: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// NewCSR creates a key and a certificate request for it.
+func NewCSR(commonName string, organization []string) (csrPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName, Organization: organization},
+	}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM, err = encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), keyPEM, nil
+}
+
+// WriteKeyPair writes a certificate and its key, replacing each file
+// atomically so that a CertReloader never sees a partial write.
+func WriteKeyPair(certFile, keyFile string, certPEM, keyPEM []byte) error {
+	if err := writeAtomic(keyFile, keyPEM, 0600); err != nil {
+		return fmt.Errorf("error writing key: %w", err)
+	}
+	if err := writeAtomic(certFile, certPEM, 0644); err != nil {
+		return fmt.Errorf("error writing certificate: %w", err)
+	}
+	return nil
+}
+
+// CertificateExpiry returns the expiry of the first certificate in certFile.
+func CertificateExpiry(certFile string) (notBefore, notAfter time.Time, err error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return notBefore, notAfter, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return notBefore, notAfter, fmt.Errorf("no certificate found in %s", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return notBefore, notAfter, err
+	}
+	return cert.NotBefore, cert.NotAfter, nil
+}
+
+// NeedsRenewal reports whether the certificate in certFile is missing or has
+// used up two thirds of its lifetime.
+func NeedsRenewal(certFile string) bool {
+	notBefore, notAfter, err := CertificateExpiry(certFile)
+	if err != nil {
+		return true
+	}
+	renewAt := notBefore.Add(notAfter.Sub(notBefore) * 2 / 3)
+	return time.Now().After(renewAt)
+}
+
+// MaintainCertificate keeps certFile and keyFile holding a certificate issued
+// by the CA, issuing a new one whenever the current one is due for renewal.
+func (ca *CA) MaintainCertificate(ctx context.Context, l *log.Logger, commonName string, organization, hosts []string, certFile, keyFile string) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if NeedsRenewal(certFile) {
+			if err := ca.IssueToFiles(commonName, organization, hosts, certFile, keyFile); err != nil {
+				l.Printf("error renewing certificate for %s: %v\n", commonName, err)
+			} else {
+				l.Printf("issued certificate for %s\n", commonName)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (ca *CA) IssueToFiles(commonName string, organization, hosts []string, certFile, keyFile string) error {
+	certPEM, keyPEM, err := ca.Issue(commonName, organization, hosts)
+	if err != nil {
+		return err
+	}
+	return WriteKeyPair(certFile, keyFile, certPEM, keyPEM)
+}
+
+func writeAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestSignCSR(t *testing.T) {
+	ca, _, err := NewCA("test-ca")
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+
+	// The request asks to be the manager and for extra names; only its key
+	// may end up in the certificate.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: "manager", Organization: []string{GroupManagers}},
+		DNSNames:    []string{"manager.example"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+
+	certPEM, err := ca.SignCSR(csr, pkix.Name{CommonName: "w1:5555", Organization: []string{GroupWorkers}}, []string{"10.0.0.5"})
+	if err != nil {
+		t.Fatalf("SignCSR: %v", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+
+	if cert.Subject.CommonName != "w1:5555" || !slices.Equal(cert.Subject.Organization, []string{GroupWorkers}) {
+		t.Errorf("subject = %v, want the one given by the caller", cert.Subject)
+	}
+	if len(cert.DNSNames) != 0 || len(cert.IPAddresses) != 1 || !cert.IPAddresses[0].Equal(net.ParseIP("10.0.0.5")) {
+		t.Errorf("names = %v %v, want only 10.0.0.5", cert.DNSNames, cert.IPAddresses)
+	}
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		t.Errorf("certificate is not for the requested key")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("certificate does not verify as a client certificate: %v", err)
+	}
+}
+
+func TestSignCSRInvalid(t *testing.T) {
+	ca, _, err := NewCA("test-ca")
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	csr, _, err := NewCSR("w1:5555", nil)
+	if err != nil {
+		t.Fatalf("NewCSR: %v", err)
+	}
+	tampered := []byte(string(csr))
+	block, _ := pem.Decode(tampered)
+	block.Bytes[len(block.Bytes)-1] ^= 0xff
+
+	tests := []struct {
+		name string
+		csr  []byte
+	}{
+		{name: "empty", csr: nil},
+		{name: "not pem", csr: []byte("hello")},
+		{name: "certificate instead of request", csr: ca.CertPEM},
+		{name: "bad signature", csr: pem.EncodeToMemory(block)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ca.SignCSR(tt.csr, pkix.Name{CommonName: "w1:5555"}, nil); err == nil {
+				t.Errorf("SignCSR() succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+const (
+	VerbGet    = "get"
+	VerbList   = "list"
+	VerbWatch  = "watch"
+	VerbCreate = "create"
+	VerbUpdate = "update"
+	VerbDelete = "delete"
+
+	Wildcard = "*"
+
+	Anonymous            = "system:anonymous"
+	GroupUnauthenticated = "system:unauthenticated"
+	GroupAuthenticated   = "system:authenticated"
+	GroupWorkers         = "system:workers"
+	GroupManagers        = "system:managers"
+)
+
+type Rule struct {
+	Verbs     []string
+	Resources []string
+}
+
+func (r Rule) matches(verb, resource string) bool {
+	return (slices.Contains(r.Verbs, Wildcard) || slices.Contains(r.Verbs, verb)) &&
+		(slices.Contains(r.Resources, Wildcard) || slices.Contains(r.Resources, resource))
+}
+
+type Role struct {
+	Name  string
+	Rules []Rule
+}
+
+// Binding grants a role to users and to members of groups, either in the
+// listed namespaces or, without any, cluster-wide.
+type Binding struct {
+	Role       string
+	Users      []string
+	Groups     []string
+	Namespaces []string
+}
+
+func (b Binding) appliesTo(p Principal, namespace string) bool {
+	if len(b.Namespaces) > 0 && !slices.Contains(b.Namespaces, namespace) {
+		return false
+	}
+	if slices.Contains(b.Users, p.Name) {
+		return true
+	}
+	for _, g := range p.Groups {
+		if slices.Contains(b.Groups, g) {
+			return true
+		}
+	}
+	return false
+}
+
+type Policy struct {
+	Roles    []Role
+	Bindings []Binding
+}
+
+// DefaultRoles are available to bindings without being defined in the
+// policy file. A role of the same name in the file replaces the default.
+func DefaultRoles() []Role {
+	return []Role{
+		{
+			Name:  "viewer",
+			Rules: []Rule{{Verbs: []string{VerbGet, VerbList, VerbWatch}, Resources: []string{"tasks", "nodes", "quotas", "metrics"}}},
+		},
+		{
+			Name: "operator",
+			Rules: []Rule{
+				{Verbs: []string{VerbGet, VerbList, VerbWatch}, Resources: []string{"tasks", "nodes", "quotas", "metrics"}},
+				{Verbs: []string{VerbCreate, VerbUpdate, VerbDelete}, Resources: []string{"tasks"}},
+			},
+		},
+		{
+			Name:  "admin",
+			Rules: []Rule{{Verbs: []string{Wildcard}, Resources: []string{Wildcard}}},
+		},
+		{
+			Name: "worker",
+			Rules: []Rule{
+				{Verbs: []string{VerbCreate}, Resources: []string{"nodes"}},
+				{Verbs: []string{VerbUpdate}, Resources: []string{"nodes/tasks"}},
+			},
+		},
+	}
+}
+
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rbac policy: %w", err)
+	}
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("error decoding rbac policy: %w", err)
+	}
+
+	for _, d := range DefaultRoles() {
+		if p.role(d.Name) == nil {
+			p.Roles = append(p.Roles, d)
+		}
+	}
+
+	return &p, p.validate()
+}
+
+func (p *Policy) validate() error {
+	for _, r := range p.Roles {
+		if r.Name == "" {
+			return fmt.Errorf("role must have a name")
+		}
+	}
+	for _, b := range p.Bindings {
+		if p.role(b.Role) == nil {
+			return fmt.Errorf("binding refers to unknown role %q", b.Role)
+		}
+	}
+	return nil
+}
+
+func (p *Policy) role(name string) *Role {
+	for i := range p.Roles {
+		if p.Roles[i].Name == name {
+			return &p.Roles[i]
+		}
+	}
+	return nil
+}
+
+// Allowed reports whether any role bound to the principal permits the verb
+// on the resource in namespace. Requests outside any namespace are only
+// allowed by cluster-wide bindings.
+func (p *Policy) Allowed(pr Principal, verb, resource, namespace string) bool {
+	for _, b := range p.Bindings {
+		if !b.appliesTo(pr, namespace) {
+			continue
+		}
+		role := p.role(b.Role)
+		for _, rule := range role.Rules {
+			if rule.matches(verb, resource) {
+				return true
+			}
+		}
+	}
+	return false
+}
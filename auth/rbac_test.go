@@ -0,0 +1,55 @@
+package auth
+
+import "testing"
+
+func TestPolicyAllowed(t *testing.T) {
+	p := &Policy{
+		Roles: append(DefaultRoles(), Role{
+			Name:  "submitter",
+			Rules: []Rule{{Verbs: []string{VerbCreate}, Resources: []string{"tasks"}}},
+		}),
+		Bindings: []Binding{
+			{Role: "admin", Users: []string{"root"}},
+			{Role: "viewer", Groups: []string{GroupAuthenticated}},
+			{Role: "operator", Users: []string{"alice"}, Namespaces: []string{"team-a"}},
+			{Role: "submitter", Groups: []string{"ci"}, Namespaces: []string{"team-a", "team-b"}},
+			{Role: "worker", Groups: []string{GroupWorkers}},
+		},
+	}
+
+	alice := Principal{Name: "alice", Groups: []string{GroupAuthenticated}}
+	ci := Principal{Name: "runner", Groups: []string{"ci"}}
+	anon := Principal{Name: Anonymous, Groups: []string{GroupUnauthenticated}}
+	worker := Principal{Name: "w1:5555", Groups: []string{GroupWorkers}}
+
+	tests := []struct {
+		name      string
+		principal Principal
+		verb      string
+		resource  string
+		namespace string
+		want      bool
+	}{
+		{"cluster admin anywhere", Principal{Name: "root"}, VerbDelete, "nodes", "", true},
+		{"cluster admin in a namespace", Principal{Name: "root"}, VerbDelete, "tasks", "team-z", true},
+		{"namespaced operator in its namespace", alice, VerbDelete, "tasks", "team-a", true},
+		{"namespaced operator in another namespace", alice, VerbDelete, "tasks", "team-b", false},
+		{"namespaced operator outside any namespace", alice, VerbDelete, "tasks", "", false},
+		{"cluster viewer through a group", alice, VerbList, "tasks", "team-b", true},
+		{"viewer cannot write", alice, VerbCreate, "tasks", "team-b", false},
+		{"group binding in listed namespace", ci, VerbCreate, "tasks", "team-b", true},
+		{"group binding verb not in role", ci, VerbDelete, "tasks", "team-b", false},
+		{"group binding in unlisted namespace", ci, VerbCreate, "tasks", "team-c", false},
+		{"anonymous", anon, VerbGet, "tasks", "", false},
+		{"worker reports tasks", worker, VerbUpdate, "nodes/tasks", "", true},
+		{"worker cannot read tasks", worker, VerbGet, "tasks", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Allowed(tt.principal, tt.verb, tt.resource, tt.namespace); got != tt.want {
+				t.Errorf("Allowed(%s, %s, %s, %q) = %v, want %v", tt.principal.Name, tt.verb, tt.resource, tt.namespace, got, tt.want)
+			}
+		})
+	}
+}
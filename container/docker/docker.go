@@ -2,14 +2,21 @@ package docker
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 
+	"github.com/distribution/reference"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"github.com/reversearrow/orchestrator/task"
@@ -18,8 +25,9 @@ import (
 type Action = string
 
 const (
-	Start Action = "Start"
-	Stop  Action = "Stop"
+	Start  Action = "Start"
+	Stop   Action = "Stop"
+	Update Action = "Update"
 )
 
 type ResultTypes = string
@@ -28,33 +36,82 @@ const (
 	Success ResultTypes = "Success"
 )
 
+type PullPolicy = string
+
+const (
+	PullAlways       PullPolicy = "Always"
+	PullIfNotPresent PullPolicy = "IfNotPresent"
+	PullNever        PullPolicy = "Never"
+)
+
+type PullProgress struct {
+	Image   string
+	Layer   string
+	Status  string
+	Current int64
+	Total   int64
+}
+
 type Config struct {
-	Name          string
-	AttachStdin   bool
-	AttachStdout  bool
-	AttachStderr  bool
-	ExposedPorts  nat.PortSet
-	Cmd           []string
-	Image         string
-	Cpu           float64
-	Memory        int64
-	Disk          int64
-	Env           []string
-	RestartPolicy container.RestartPolicyMode
+	Name           string
+	AttachStdin    bool
+	AttachStdout   bool
+	AttachStderr   bool
+	ExposedPorts   nat.PortSet
+	Cmd            []string
+	Entrypoint     []string
+	WorkingDir     string
+	User           string
+	Labels         map[string]string
+	Image          string
+	Cpu            float64
+	CpuShares      int64
+	Memory         int64
+	Disk           int64
+	Env            []string
+	RestartPolicy  container.RestartPolicyMode
+	PullPolicy     PullPolicy
+	RegistryAuth   string
+	OnPullProgress func(PullProgress)
 	Runtime
 }
 
 func NewConfig(t *task.Task) *Config {
 	return &Config{
-		Name:          t.Name,
+		Name:          containerName(t),
 		Image:         t.Image,
+		Cmd:           t.Cmd,
+		Entrypoint:    t.Entrypoint,
+		Env:           t.Env,
+		WorkingDir:    t.WorkingDir,
+		User:          t.User,
+		Labels:        t.Labels,
+		Cpu:           t.CpuLimit,
+		CpuShares:     int64(t.CpuRequested() * 1024),
 		Memory:        int64(t.Memory),
 		Disk:          int64(t.Disk),
 		ExposedPorts:  t.ExposedPorts,
 		RestartPolicy: container.RestartPolicyMode(t.RestartPolicy),
+		PullPolicy:    t.ImagePullPolicy,
 	}
 }
 
+// containerName names the container of t after its namespace, name and ID.
+// Task names are only unique within a namespace and can be reused once a
+// task has finished, so the ID keeps the name unique on the host.
+func containerName(t *task.Task) string {
+	parts := make([]string, 0, 3)
+	for _, p := range []string{t.Namespace, t.Name} {
+		if p = strings.Trim(containerNameReplacer.ReplaceAllString(p, "-"), "-_."); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	parts = append(parts, t.ID.String()[:8])
+	return strings.Join(parts, "-")
+}
+
+var containerNameReplacer = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
 type Runtime struct {
 	ContainerID string
 }
@@ -91,23 +148,23 @@ func (d *Docker) validate() error {
 }
 
 func (d *Docker) Run(ctx context.Context) task.Result {
-	reader, err := d.Client.ImagePull(ctx, d.Config.Image, types.ImagePullOptions{})
-	if err != nil {
-		msg := fmt.Sprintf("error pulling the docker image: %q", d.Config.Image)
+	if err := d.PullImage(ctx); err != nil {
 		return task.Result{
-			Error: fmt.Errorf("msg: %s, %w", msg, err),
+			Error: err,
 		}
 	}
-	io.Copy(os.Stdout, reader)
+
 	rp := container.RestartPolicy{
 		Name: d.Config.RestartPolicy,
 	}
-	r := container.Resources{
-		Memory:   d.Config.Memory,
-		NanoCPUs: int64(d.Config.Cpu * math.Pow(10, 9)),
-	}
+	r := d.resources()
 	cc := container.Config{
 		Image:        d.Config.Image,
+		Cmd:          d.Config.Cmd,
+		Entrypoint:   d.Config.Entrypoint,
+		WorkingDir:   d.Config.WorkingDir,
+		User:         d.Config.User,
+		Labels:       d.Config.Labels,
 		Tty:          false,
 		Env:          d.Config.Env,
 		ExposedPorts: d.Config.ExposedPorts,
@@ -117,8 +174,19 @@ func (d *Docker) Run(ctx context.Context) task.Result {
 		Resources:       r,
 		PublishAllPorts: true,
 	}
+	if d.Config.Disk > 0 {
+		hc.StorageOpt = map[string]string{
+			"size": strconv.FormatInt(d.Config.Disk, 10),
+		}
+	}
 
 	resp, err := d.Client.ContainerCreate(ctx, &cc, &hc, nil, nil, d.Config.Name)
+	if err != nil && hc.StorageOpt != nil && isStorageOptUnsupported(err) {
+		// The storage driver cannot enforce a size quota, the worker falls
+		// back to tracking the container's writable layer instead.
+		hc.StorageOpt = nil
+		resp, err = d.Client.ContainerCreate(ctx, &cc, &hc, nil, nil, d.Config.Name)
+	}
 	if err != nil {
 		msg := fmt.Sprintf("error creating the docker image: %q", d.Config.Image)
 		return task.Result{
@@ -160,6 +228,160 @@ func (d *Docker) Run(ctx context.Context) task.Result {
 	}
 }
 
+// PullImage makes the configured image available locally according to the
+// pull policy. Without an explicit policy, images tagged latest (or untagged)
+// are always pulled and everything else is pulled only when missing.
+func (d *Docker) PullImage(ctx context.Context) error {
+	policy := d.Config.PullPolicy
+	if policy == "" {
+		policy = defaultPullPolicy(d.Config.Image)
+	}
+
+	if policy != PullAlways {
+		present, err := d.imagePresent(ctx)
+		if err != nil {
+			return err
+		}
+		if present {
+			return nil
+		}
+		if policy == PullNever {
+			return fmt.Errorf("image %q is not present and pull policy is %s", d.Config.Image, PullNever)
+		}
+	}
+
+	reader, err := d.Client.ImagePull(ctx, d.Config.Image, types.ImagePullOptions{
+		RegistryAuth: d.Config.RegistryAuth,
+	})
+	if err != nil {
+		msg := fmt.Sprintf("error pulling the docker image: %q", d.Config.Image)
+		return fmt.Errorf("msg: %s, %w", msg, err)
+	}
+	defer reader.Close()
+
+	return d.readPullProgress(reader)
+}
+
+func (d *Docker) imagePresent(ctx context.Context) (bool, error) {
+	_, _, err := d.Client.ImageInspectWithRaw(ctx, d.Config.Image)
+	if err == nil {
+		return true, nil
+	}
+	if client.IsErrNotFound(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("error inspecting the docker image %q: %w", d.Config.Image, err)
+}
+
+func (d *Docker) readPullProgress(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("error reading pull progress for %q: %w", d.Config.Image, err)
+		}
+
+		if msg.Error != nil {
+			return fmt.Errorf("error pulling the docker image %q: %s", d.Config.Image, msg.Error.Message)
+		}
+
+		if d.Config.OnPullProgress == nil {
+			continue
+		}
+		p := PullProgress{
+			Image:  d.Config.Image,
+			Layer:  msg.ID,
+			Status: msg.Status,
+		}
+		if msg.Progress != nil {
+			p.Current = msg.Progress.Current
+			p.Total = msg.Progress.Total
+		}
+		d.Config.OnPullProgress(p)
+	}
+}
+
+func defaultPullPolicy(image string) PullPolicy {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return PullAlways
+	}
+	if _, ok := named.(reference.Digested); ok {
+		return PullIfNotPresent
+	}
+	tagged, ok := named.(reference.Tagged)
+	if !ok || tagged.Tag() == "latest" {
+		return PullAlways
+	}
+	return PullIfNotPresent
+}
+
+// RegistryDomain returns the registry host an image is pulled from.
+func RegistryDomain(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("error parsing image reference %q: %w", image, err)
+	}
+	return reference.Domain(named), nil
+}
+
+// Update applies the configured resources and restart policy to a running
+// container without recreating it.
+func (d *Docker) Update(ctx context.Context, id string) task.Result {
+	_, err := d.Client.ContainerUpdate(ctx, id, container.UpdateConfig{
+		Resources: d.resources(),
+		RestartPolicy: container.RestartPolicy{
+			Name: d.Config.RestartPolicy,
+		},
+	})
+	if err != nil {
+		return task.Result{
+			Error: fmt.Errorf("error updating the container: %w", err),
+		}
+	}
+
+	return task.Result{
+		ContainerId: id,
+		Action:      Update,
+		Result:      Success,
+	}
+}
+
+func (d *Docker) resources() container.Resources {
+	return container.Resources{
+		Memory:    d.Config.Memory,
+		NanoCPUs:  int64(d.Config.Cpu * math.Pow(10, 9)),
+		CPUShares: d.Config.CpuShares,
+	}
+}
+
+func (d *Docker) Inspect(ctx context.Context, id string) (*types.ContainerState, error) {
+	c, err := d.Client.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error inspecting the container: %w", err)
+	}
+	return c.State, nil
+}
+
+func (d *Docker) DiskUsage(ctx context.Context, id string) (int64, error) {
+	c, _, err := d.Client.ContainerInspectWithRaw(ctx, id, true)
+	if err != nil {
+		return 0, fmt.Errorf("error inspecting the container: %w", err)
+	}
+
+	if c.SizeRw == nil {
+		return 0, nil
+	}
+	return *c.SizeRw, nil
+}
+
+func isStorageOptUnsupported(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "storage-opt")
+}
+
 func (d *Docker) Stop(ctx context.Context, id string) task.Result {
 	if err := d.Client.ContainerStop(ctx, id, container.StopOptions{}); err != nil {
 		return task.Result{
@@ -0,0 +1,31 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+func TestContainerName(t *testing.T) {
+	id := uuid.MustParse("0b7e3a52-9c1d-4c4e-8f5a-2d6b1e0f3a44")
+
+	tests := []struct {
+		namespace string
+		name      string
+		want      string
+	}{
+		{namespace: "team-a", name: "web", want: "team-a-web-0b7e3a52"},
+		{namespace: "team-a", name: "", want: "team-a-0b7e3a52"},
+		{namespace: "", name: "web", want: "web-0b7e3a52"},
+		{namespace: "team-a", name: "my web/app", want: "team-a-my-web-app-0b7e3a52"},
+		{namespace: "team-a", name: "_hidden.", want: "team-a-hidden-0b7e3a52"},
+	}
+
+	for _, tt := range tests {
+		got := containerName(&task.Task{ID: id, Namespace: tt.namespace, Name: tt.name})
+		if got != tt.want {
+			t.Errorf("containerName(%q, %q) = %q, want %q", tt.namespace, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+type Image struct {
+	ID      string
+	Tags    []string
+	Size    int64
+	Created int64
+	InUse   bool
+}
+
+// ListImages returns the images present on the host, oldest first. An image
+// is in use when any container, running or not, was created from it.
+func (d *Docker) ListImages(ctx context.Context) ([]Image, error) {
+	summaries, err := d.Client.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing images: %w", err)
+	}
+
+	containers, err := d.Client.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, fmt.Errorf("error listing containers: %w", err)
+	}
+	inUse := make(map[string]bool, len(containers))
+	for _, c := range containers {
+		inUse[c.ImageID] = true
+	}
+
+	images := make([]Image, 0, len(summaries))
+	for _, s := range summaries {
+		images = append(images, Image{
+			ID:      s.ID,
+			Tags:    s.RepoTags,
+			Size:    s.Size,
+			Created: s.Created,
+			InUse:   inUse[s.ID],
+		})
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Created < images[j].Created
+	})
+
+	return images, nil
+}
+
+func (d *Docker) RemoveImage(ctx context.Context, id string) error {
+	if _, err := d.Client.ImageRemove(ctx, id, types.ImageRemoveOptions{PruneChildren: true}); err != nil {
+		return fmt.Errorf("error removing image %q: %w", id, err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,7 +14,9 @@ import (
 
 	"github.com/golang-collections/collections/queue"
 	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/auth"
 	"github.com/reversearrow/orchestrator/manager"
+	"github.com/reversearrow/orchestrator/node"
 	"github.com/reversearrow/orchestrator/task"
 	"github.com/reversearrow/orchestrator/worker"
 )
@@ -29,52 +32,227 @@ func main() {
 		return
 	}
 
+	mgrHost := os.Getenv("CUBE_MANAGER_HOST")
+	mgrPort, err := strconv.Atoi(os.Getenv("CUBE_MANAGER_PORT"))
+	if err != nil {
+		logger.Printf("failed to parse CUBE_MANAGER_PORT: %v", err)
+		os.Exit(1)
+		return
+	}
+
+	client := http.Client{
+		Timeout: time.Second * 30,
+	}
+
+	scheme := "http"
+	if os.Getenv("CUBE_TLS") == "true" {
+		scheme = "https"
+	}
+
+	// In CA mode the manager issues its own certificate and those of the
+	// workers that register with it.
+	var ca *auth.CA
+	if caCert := os.Getenv("CUBE_MANAGER_CA_CERT"); caCert != "" {
+		ca, err = auth.LoadOrCreateCA(caCert, os.Getenv("CUBE_MANAGER_CA_KEY"), "cube-ca")
+		if err != nil {
+			logger.Printf("failed to load the manager ca: %v", err)
+			os.Exit(1)
+		}
+
+		if cert := os.Getenv("CUBE_MANAGER_TLS_CERT"); cert != "" && auth.NeedsRenewal(cert) {
+			err := ca.IssueToFiles("manager", []string{auth.GroupManagers}, []string{mgrHost}, cert, os.Getenv("CUBE_MANAGER_TLS_KEY"))
+			if err != nil {
+				logger.Printf("failed to issue the manager certificate: %v", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	workerClient, err := authenticatedClient("CUBE_WORKER")
+	if err != nil {
+		logger.Printf("failed to configure the worker client: %v", err)
+		os.Exit(1)
+	}
+
+	mgrClient, err := authenticatedClient("CUBE_MANAGER")
+	if err != nil {
+		logger.Printf("failed to configure the manager client: %v", err)
+		os.Exit(1)
+	}
+
 	w, err := worker.NewWorker(logger, queue.New(), make(map[uuid.UUID]*task.Task))
 	if err != nil {
 		logger.Printf("error creating a new worker: %v", err)
 		os.Exit(1)
 	}
+	w.Name = fmt.Sprintf("%s:%d", host, port)
 
-	workerAPI := worker.Api{
-		Address: host,
-		Port:    port,
-		Worker:  w,
-		Logger:  logger,
+	w.Reporter, err = worker.NewReporter(logger, workerClient, fmt.Sprintf("%s:%d", mgrHost, mgrPort), w.Name)
+	if err != nil {
+		logger.Printf("error creating a new task reporter: %v", err)
+		os.Exit(1)
 	}
+	w.Reporter.Scheme = scheme
 
-	workerAPI.Start()
-
-	client := http.Client{
-		Timeout: time.Second * 30,
+	if path := os.Getenv("CUBE_WORKER_REGISTRY_AUTH"); path != "" {
+		w.Registries, err = worker.LoadRegistryCredentials(path)
+		if err != nil {
+			logger.Printf("error loading registry credentials: %v", err)
+			os.Exit(1)
+		}
 	}
 
 	workers := []string{
-		fmt.Sprintf("%s:%d", host, port),
+		w.Name,
 	}
 
-	mgr, err := manager.NewManager(logger, &client, workers)
+	mgr, err := manager.NewManager(logger, mgrClient, workers)
 	if err != nil {
 		logger.Printf("error creating a new manager: %v", err)
 		os.Exit(1)
 	}
+	mgr.Scheme = scheme
+	mgr.Preemption = os.Getenv("CUBE_MANAGER_PREEMPTION") == "true"
 
-	mgrHost := os.Getenv("CUBE_MANAGER_HOST")
-	mgrPort, err := strconv.Atoi(os.Getenv("CUBE_MANAGER_PORT"))
-	if err != nil {
-		logger.Printf("failed to parse CUBE_MANAGER_PORT: %v", err)
-		os.Exit(1)
-		return
+	if weights := os.Getenv("CUBE_MANAGER_QUEUE_WEIGHTS"); weights != "" {
+		mgr.Pending.Weights, err = manager.ParseQueueWeights(weights)
+		if err != nil {
+			logger.Printf("failed to parse CUBE_MANAGER_QUEUE_WEIGHTS: %v", err)
+			os.Exit(1)
+		}
 	}
+
+	if path := os.Getenv("CUBE_MANAGER_QUOTAS"); path != "" {
+		quotas, err := manager.LoadQuotas(path)
+		if err != nil {
+			logger.Printf("error loading quotas: %v", err)
+			os.Exit(1)
+		}
+		mgr.SetQuotas(quotas)
+	}
+
+	if path := os.Getenv("CUBE_MANAGER_ADMISSION_WEBHOOKS"); path != "" {
+		configs, err := manager.LoadWebhookConfigs(path)
+		if err != nil {
+			logger.Printf("error loading admission webhooks: %v", err)
+			os.Exit(1)
+		}
+		for _, cfg := range configs {
+			wh, err := manager.NewWebhook(logger, &client, cfg)
+			if err != nil {
+				logger.Printf("error creating admission webhook: %v", err)
+				os.Exit(1)
+			}
+			mgr.Admission = append(mgr.Admission, wh)
+		}
+	}
+
 	mgrAPI, err := manager.NewApi(logger, mgr, mgrHost, mgrPort)
 	if err != nil {
 		logger.Printf("failed to create new api for the manager: %v\n", err)
 		os.Exit(0)
 	}
+	mgrAPI.CA = ca
+
+	if window := os.Getenv("CUBE_MANAGER_IDEMPOTENCY_WINDOW"); window != "" {
+		d, err := time.ParseDuration(window)
+		if err != nil {
+			logger.Printf("failed to parse CUBE_MANAGER_IDEMPOTENCY_WINDOW: %v", err)
+			os.Exit(1)
+		}
+		mgrAPI.Idempotency.Window = d
+	}
+
+	mgrAPI.Auth, mgrAPI.TLSConfig, err = serverAuth(logger, "CUBE_MANAGER")
+	if err != nil {
+		logger.Printf("failed to configure manager api authentication: %v", err)
+		os.Exit(1)
+	}
+	if ca != nil && mgrAPI.Auth == nil {
+		logger.Printf("CUBE_MANAGER_CA_CERT requires CUBE_MANAGER_TOKENS or CUBE_MANAGER_TLS_CLIENT_CA so that only authenticated workers get certificates")
+		os.Exit(1)
+	}
+
+	if path := os.Getenv("CUBE_MANAGER_RBAC_POLICY"); path != "" {
+		mgrAPI.Policy, err = auth.LoadPolicy(path)
+		if err != nil {
+			logger.Printf("error loading rbac policy: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	if path := os.Getenv("CUBE_MANAGER_AUDIT_LOG"); path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			logger.Printf("error opening audit log: %v", err)
+			os.Exit(1)
+		}
+		mgrAPI.Audit = log.New(f, "", log.LstdFlags)
+	}
 
 	mgrAPI.Start()
 
+	reg, err := worker.NewRegistration(logger, workerClient, fmt.Sprintf("%s:%d", mgrHost, mgrPort), w.Name)
+	if err != nil {
+		logger.Printf("error creating the worker registration: %v", err)
+		os.Exit(1)
+	}
+	reg.Scheme = scheme
+	if labels := os.Getenv("CUBE_WORKER_LABELS"); labels != "" {
+		reg.Labels, err = node.ParseLabels(labels)
+		if err != nil {
+			logger.Printf("failed to parse CUBE_WORKER_LABELS: %v", err)
+			os.Exit(1)
+		}
+	}
+	if taints := os.Getenv("CUBE_WORKER_TAINTS"); taints != "" {
+		reg.Taints, err = node.ParseTaints(taints)
+		if err != nil {
+			logger.Printf("failed to parse CUBE_WORKER_TAINTS: %v", err)
+			os.Exit(1)
+		}
+	}
+	if os.Getenv("CUBE_WORKER_REQUEST_CERT") == "true" {
+		reg.CertFile = os.Getenv("CUBE_WORKER_TLS_CERT")
+		reg.KeyFile = os.Getenv("CUBE_WORKER_TLS_KEY")
+	}
+	if err := reg.RegisterWithRetry(5); err != nil {
+		logger.Printf("failed to register the worker: %v", err)
+		if reg.CertFile != "" {
+			os.Exit(1)
+		}
+	}
+
+	workerAPI := worker.Api{
+		Address: host,
+		Port:    port,
+		Worker:  w,
+		Logger:  logger,
+	}
+
+	// The worker only accepts the manager: its CUBE_MANAGER_CLIENT_TOKEN must
+	// be listed in CUBE_WORKER_TOKENS with the system:managers group, or its
+	// client certificate must carry that group as organization.
+	workerAPI.Auth, workerAPI.TLSConfig, err = serverAuth(logger, "CUBE_WORKER")
+	if err != nil {
+		logger.Printf("failed to configure worker api authentication: %v", err)
+		os.Exit(1)
+	}
+
+	workerAPI.Start()
+
+	if ca != nil && os.Getenv("CUBE_MANAGER_TLS_CERT") != "" {
+		go ca.MaintainCertificate(context.TODO(), logger, "manager", []string{auth.GroupManagers}, []string{mgrHost}, os.Getenv("CUBE_MANAGER_TLS_CERT"), os.Getenv("CUBE_MANAGER_TLS_KEY"))
+	}
+
 	go w.RunTasks(context.TODO(), logger)
+	go reg.Run(context.TODO())
+	go w.Reporter.Run(context.TODO())
 	go w.CollectStats()
+	go w.InspectTasks(context.TODO())
+	go w.EnforceDiskQuotas(context.TODO())
+	go w.CollectImages(context.TODO())
+	go mgr.UpdateNodes()
 	go mgr.UpdateTasks()
 	go mgr.ProcessTasks()
 
@@ -84,3 +262,54 @@ func main() {
 
 	logger.Printf("shutdown signal received: %v", sig)
 }
+
+// serverAuth configures authentication for an API from the <prefix>_TOKENS,
+// <prefix>_TLS_CERT, <prefix>_TLS_KEY and <prefix>_TLS_CLIENT_CA variables.
+// Authentication is disabled when neither tokens nor a client CA are set.
+func serverAuth(logger *log.Logger, prefix string) (*auth.Authenticator, *tls.Config, error) {
+	var tlsConfig *tls.Config
+	if cert := os.Getenv(prefix + "_TLS_CERT"); cert != "" {
+		var err error
+		tlsConfig, err = auth.ServerTLSConfig(cert, os.Getenv(prefix+"_TLS_KEY"), os.Getenv(prefix+"_TLS_CLIENT_CA"))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var tokens []auth.Token
+	if path := os.Getenv(prefix + "_TOKENS"); path != "" {
+		var err error
+		tokens, err = auth.LoadTokens(path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(tokens) == 0 && (tlsConfig == nil || tlsConfig.ClientCAs == nil) {
+		return nil, tlsConfig, nil
+	}
+
+	a, err := auth.NewAuthenticator(logger, tokens)
+	return a, tlsConfig, err
+}
+
+// authenticatedClient builds the client a component uses to call the other
+// one, presenting the <prefix>_CLIENT_TOKEN bearer token and the
+// <prefix>_CLIENT_CERT and <prefix>_CLIENT_KEY certificate when set, and
+// verifying the other side against <prefix>_CLIENT_CA.
+func authenticatedClient(prefix string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	cfg, err := auth.ClientTLSConfig(os.Getenv(prefix+"_CLIENT_CERT"), os.Getenv(prefix+"_CLIENT_KEY"), os.Getenv(prefix+"_CLIENT_CA"))
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = cfg
+
+	return &http.Client{
+		Timeout: time.Second * 30,
+		Transport: &auth.TokenTransport{
+			Token: os.Getenv(prefix + "_CLIENT_TOKEN"),
+			Base:  transport,
+		},
+	}, nil
+}
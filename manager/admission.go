@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+var ErrAdmissionDenied = errors.New("admission denied")
+
+// AdmissionController inspects a task submission before it enters Pending.
+// It may change the event in place, or return an error to reject it.
+type AdmissionController interface {
+	Name() string
+	Admit(te *task.TaskEvent) error
+}
+
+// AdmissionError is returned when a controller rejects a submission.
+type AdmissionError struct {
+	Controller string
+	Reason     string
+}
+
+func (e *AdmissionError) Error() string {
+	return fmt.Sprintf("%v by %s: %s", ErrAdmissionDenied, e.Controller, e.Reason)
+}
+
+func (e *AdmissionError) Is(target error) bool {
+	return target == ErrAdmissionDenied
+}
+
+// Admit runs te through the admission chain and then validates the result,
+// so that no controller can let an invalid task through. It must not be
+// called with m.mu held: controllers may be slow.
+func (m *Manager) Admit(te *task.TaskEvent) error {
+	for _, c := range m.Admission {
+		before := *te
+		if err := c.Admit(te); err != nil {
+			if errors.Is(err, ErrAdmissionDenied) || errors.Is(err, ErrInvalidTask) {
+				return err
+			}
+			return &AdmissionError{Controller: c.Name(), Reason: err.Error()}
+		}
+		if err := checkIdentity(before, *te); err != nil {
+			return &AdmissionError{Controller: c.Name(), Reason: err.Error()}
+		}
+	}
+	return ValidateTaskEvent(*te)
+}
+
+// checkIdentity rejects a controller's change to the IDs or the namespace of
+// an event, which the API has already authorized. A controller may only fill
+// in the ones left empty.
+func checkIdentity(before, after task.TaskEvent) error {
+	if after.Task.ID != before.Task.ID {
+		return fmt.Errorf("changing task.id is not allowed")
+	}
+	if before.ID != uuid.Nil && after.ID != before.ID {
+		return fmt.Errorf("changing id is not allowed")
+	}
+	if before.Task.Namespace != "" && after.Task.Namespace != before.Task.Namespace {
+		return fmt.Errorf("changing task.namespace is not allowed")
+	}
+	return nil
+}
+
+// Defaults fills in fields left unset by the client.
+type Defaults struct {
+	ImagePullPolicy string
+	RestartPolicy   string
+	CpuRequest      float64
+	Memory          int
+}
+
+func (d *Defaults) Name() string {
+	return "defaults"
+}
+
+func (d *Defaults) Admit(te *task.TaskEvent) error {
+	if te.ID == uuid.Nil {
+		te.ID = uuid.New()
+	}
+	if te.Task.Namespace == "" {
+		te.Task.Namespace = task.DefaultNamespace
+	}
+	if te.Task.PreemptionPolicy == "" {
+		te.Task.PreemptionPolicy = task.PreemptReschedule
+	}
+	if te.Task.ImagePullPolicy == "" {
+		te.Task.ImagePullPolicy = d.ImagePullPolicy
+	}
+	if te.Task.RestartPolicy == "" {
+		te.Task.RestartPolicy = d.RestartPolicy
+	}
+	if te.Task.CpuRequest == 0 && te.Task.CpuLimit == 0 {
+		te.Task.CpuRequest = d.CpuRequest
+	}
+	if te.Task.Memory == 0 {
+		te.Task.Memory = d.Memory
+	}
+	return nil
+}
@@ -1,14 +1,23 @@
 package manager
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/auth"
+	"github.com/reversearrow/orchestrator/node"
 	"github.com/reversearrow/orchestrator/task"
 )
 
@@ -18,14 +27,24 @@ type Api struct {
 	Manager *Manager
 	Router  *chi.Mux
 	Logger  *log.Logger
+
+	Auth      *auth.Authenticator
+	TLSConfig *tls.Config
+
+	Idempotency *IdempotencyCache
+	CA          *auth.CA
+	Policy      *auth.Policy
+	Audit       *log.Logger
 }
 
 func NewApi(l *log.Logger, m *Manager, address string, port int) (*Api, error) {
 	a := &Api{
-		Logger:  l,
-		Manager: m,
-		Address: address,
-		Port:    port,
+		Logger:      l,
+		Manager:     m,
+		Address:     address,
+		Port:        port,
+		Idempotency: NewIdempotencyCache(defaultIdempotencyWindow),
+		Audit:       l,
 	}
 	return a, a.validate()
 }
@@ -43,10 +62,18 @@ func (a *Api) validate() error {
 		return fmt.Errorf("logger is nil")
 	}
 
+	if a.Audit == nil {
+		return fmt.Errorf("audit logger is nil")
+	}
+
 	if a.Manager == nil {
 		return fmt.Errorf("manager is nil")
 	}
 
+	if a.Idempotency == nil {
+		return fmt.Errorf("idempotency cache is nil")
+	}
+
 	if a.Logger == nil {
 		return fmt.Errorf("logger is nil")
 	}
@@ -57,14 +84,26 @@ func (a *Api) validate() error {
 type ErrorResponse struct {
 	HTTPStatusCode int
 	Message        string
+	Errors         []FieldError `json:",omitempty"`
 }
 
+// StartTaskHandler enqueues a new task. Submissions are deduplicated on the
+// Idempotency-Key header or, without one, on the event ID: a retried request
+// gets the original response instead of creating a second task.
 func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
-	var te task.TaskEvent
-	if err := json.NewDecoder(r.Body).Decode(&te); err != nil {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		msg := fmt.Sprintf("failed to read the request body: %v", err)
+		a.Logger.Println(msg)
+		a.writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	te, err := task.DecodeTaskEvent(bytes.NewReader(body))
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		msg := "failed to decode the request body"
-		a.Logger.Printf("%s: %v", msg, err)
+		msg := fmt.Sprintf("failed to decode the request body: %v", err)
+		a.Logger.Println(msg)
 		json.NewEncoder(w).Encode(
 			ErrorResponse{
 				HTTPStatusCode: http.StatusBadRequest,
@@ -73,14 +112,231 @@ func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a.Manager.AddTasks(te)
+	ns := chi.URLParam(r, "namespace")
+	if err := scopeEvent(ns, &te); err != nil {
+		a.Logger.Printf("rejected task %v: %v\n", te.Task.ID, err)
+		a.writeAdmissionError(w, err)
+		return
+	}
+
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" && te.ID != uuid.Nil {
+		key = "event:" + te.ID.String()
+	}
+	if key != "" {
+		key = ns + "/" + key
+	}
+	if key != "" && a.replayIdempotent(w, key, body) {
+		return
+	}
+
+	if err := a.Manager.Admit(&te); err != nil {
+		a.Logger.Printf("rejected task %v: %v\n", te.Task.ID, err)
+		if key != "" {
+			a.Idempotency.Abort(key)
+		}
+		a.writeAdmissionError(w, err)
+		return
+	}
+
+	if err := a.Manager.AddTasks(te); err != nil {
+		a.Logger.Printf("rejected task %v: %v\n", te.Task.ID, err)
+		if key != "" {
+			a.Idempotency.Abort(key)
+		}
+		a.writeAdmissionError(w, err)
+		return
+	}
 	a.Logger.Println("task added to the queue")
+
+	resp, err := json.Marshal(te)
+	if err != nil {
+		a.Logger.Printf("failed to encode the response: %v\n", err)
+	}
+	if key != "" {
+		a.Idempotency.Complete(key, http.StatusCreated, resp)
+	}
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(te)
+	w.Write(resp)
+}
+
+// replayIdempotent starts tracking a submission under key. It reports
+// whether the response has already been written, either as a replay of the
+// original response or as a rejection of a conflicting request.
+func (a *Api) replayIdempotent(w http.ResponseWriter, key string, body []byte) bool {
+	resp, err := a.Idempotency.Begin(key, body)
+	switch {
+	case errors.Is(err, ErrIdempotencyKeyReused):
+		a.Logger.Printf("rejected submission with key %q: %v\n", key, err)
+		a.writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return true
+	case errors.Is(err, ErrRequestInProgress):
+		a.Logger.Printf("rejected submission with key %q: %v\n", key, err)
+		a.writeError(w, http.StatusConflict, err.Error())
+		return true
+	case resp != nil:
+		a.Logger.Printf("replaying response for submission with key %q\n", key)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(resp.StatusCode)
+		w.Write(resp.Body)
+		return true
+	}
+	return false
+}
+
+// StartTaskBatchHandler enqueues every event in the batch, or none of them
+// if any event fails validation.
+func (a *Api) StartTaskBatchHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		msg := fmt.Sprintf("failed to read the request body: %v", err)
+		a.Logger.Println(msg)
+		a.writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	events, errs, err := DecodeTaskEventBatch(bytes.NewReader(body))
+	if err != nil {
+		msg := fmt.Sprintf("failed to decode the request body: %v", err)
+		a.Logger.Println(msg)
+		a.writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	ns := chi.URLParam(r, "namespace")
+	key := r.Header.Get("Idempotency-Key")
+	if key != "" {
+		key = ns + "/" + key
+	}
+	if key != "" && a.replayIdempotent(w, key, body) {
+		return
+	}
+
+	for i := range events {
+		if errs[i] == nil {
+			errs[i] = scopeEvent(ns, &events[i])
+		}
+		if errs[i] == nil {
+			errs[i] = a.Manager.Admit(&events[i])
+		}
+	}
+	errs, ok := a.Manager.AddTaskBatch(events, errs)
+
+	status := http.StatusCreated
+	if !ok {
+		status = http.StatusBadRequest
+	}
+	results := BatchResponse{Results: make([]BatchItemResult, len(events))}
+	for i, te := range events {
+		results.Results[i] = BatchItemResult{
+			Index:      i,
+			TaskID:     te.Task.ID,
+			StatusCode: http.StatusCreated,
+		}
+		switch {
+		case errs[i] != nil:
+			results.Results[i].StatusCode = admissionStatus(errs[i])
+			results.Results[i].Error = errs[i].Error()
+			var verr *ValidationError
+			if errors.As(errs[i], &verr) {
+				results.Results[i].Errors = verr.Errors
+			}
+		case !ok:
+			results.Results[i].StatusCode = http.StatusFailedDependency
+			results.Results[i].Error = "batch rejected"
+		}
+	}
+	if ok {
+		a.Logger.Printf("added %d tasks to the queue\n", len(events))
+	} else {
+		a.Logger.Printf("rejected batch of %d tasks\n", len(events))
+	}
+
+	resp, err := json.Marshal(results)
+	if err != nil {
+		a.Logger.Printf("failed to encode the response: %v\n", err)
+	}
+	if key != "" {
+		if ok {
+			a.Idempotency.Complete(key, status, resp)
+		} else {
+			a.Idempotency.Abort(key)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
+
+// StopTasksHandler stops every task matching the label selector given in the
+// selector query parameter, within the namespace if one is given.
+func (a *Api) StopTasksHandler(w http.ResponseWriter, r *http.Request) {
+	sel, err := task.ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		a.Logger.Printf("invalid selector: %v\n", err)
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ns := chi.URLParam(r, "namespace")
+	if ns == "" {
+		ns = r.URL.Query().Get("namespace")
+	}
+	results := a.Manager.StopTasks(ns, sel)
+	a.Logger.Printf("stopping %d tasks matching selector\n", len(results))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(BatchResponse{Results: results})
 }
 
 func (a *Api) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
-	json.NewEncoder(w).Encode(a.Manager.GetAllTasks())
+	q, err := ParseTaskQuery(r.URL.Query())
+	if err != nil {
+		a.Logger.Printf("invalid task query: %v\n", err)
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if ns := chi.URLParam(r, "namespace"); ns != "" {
+		q.Namespace = ns
+	}
+
+	tasks, next, err := a.Manager.QueryTasks(q)
+	if err != nil {
+		a.Logger.Printf("failed to query tasks: %v\n", err)
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if tasks == nil {
+		tasks = []*task.Task{}
+	}
+	json.NewEncoder(w).Encode(tasks)
+}
+
+func (a *Api) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		a.Logger.Printf("failed to parse task id from the request: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	t, ok := a.Manager.GetTask(tID)
+	if !ok {
+		a.Logger.Printf("task %v not found.\n", tID)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
 }
 
 func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -91,38 +347,581 @@ func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tID, _ := uuid.Parse(taskID)
-	taskToStop, ok := a.Manager.TaskDb[tID]
-	if !ok {
+	tID, err := uuid.Parse(taskID)
+	if err != nil {
+		a.Logger.Printf("failed to parse task id from the request: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = a.Manager.StopTask(tID)
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
 		a.Logger.Printf("task %v not found.\n", tID)
 		w.WriteHeader(http.StatusNotFound)
 		return
+	case errors.Is(err, ErrInvalidTransition):
+		a.Logger.Println(err)
+		a.writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	a.Logger.Printf("added task event to stop the task")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) PatchTaskHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		a.Logger.Printf("failed to parse task id from the request: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
-	te := task.TaskEvent{
-		ID:        uuid.New(),
-		State:     task.Completed,
-		Timestamp: time.Now().UTC(),
+	p, err := DecodeTaskPatch(r.Body)
+	if err != nil {
+		msg := fmt.Sprintf("failed to decode the request body: %v", err)
+		a.Logger.Println(msg)
+		a.writeError(w, http.StatusBadRequest, msg)
+		return
 	}
 
-	taskCopy := *taskToStop
-	taskCopy.State = task.Completed
-	te.Task = taskCopy
+	result, err := a.Manager.PatchTask(tID, p)
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		a.Logger.Printf("task %v not found.\n", tID)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case errors.Is(err, ErrInvalidTask), errors.Is(err, ErrQuotaExceeded):
+		a.Logger.Println(err)
+		a.writeAdmissionError(w, err)
+		return
+	case err != nil:
+		a.Logger.Println(err)
+		a.writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	a.Logger.Printf("patched task %v (%s)\n", tID, result.Mode)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(result)
+}
+
+func (a *Api) ReportTasksHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	tasks, err := task.DecodeTasks(r.Body)
+	if err != nil {
+		msg := fmt.Sprintf("failed to decode the request body: %v", err)
+		a.Logger.Println(msg)
+		a.writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := a.Manager.ReportTasks(name, tasks); err != nil {
+		a.Logger.Printf("failed to apply task report: %v\n", err)
+		a.writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
 
-	a.Manager.AddTasks(te)
-	a.Logger.Printf("added task event to stop the task")
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (a *Api) writeError(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(
+		ErrorResponse{
+			HTTPStatusCode: status,
+			Message:        msg,
+		})
+}
+
+// writeAdmissionError writes a rejected submission, including the field
+// errors if it failed validation.
+func (a *Api) writeAdmissionError(w http.ResponseWriter, err error) {
+	status := admissionStatus(err)
+	resp := ErrorResponse{
+		HTTPStatusCode: status,
+		Message:        err.Error(),
+	}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		resp.Errors = verr.Errors
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func admissionStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrAdmissionDenied), errors.Is(err, ErrQuotaExceeded):
+		return http.StatusForbidden
+	case errors.Is(err, ErrNameConflict), errors.Is(err, ErrTaskExists):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// scopeEvent places a task submitted under a namespaced route in that
+// namespace, rejecting a task that names a different one.
+func scopeEvent(ns string, te *task.TaskEvent) error {
+	if ns == "" {
+		return nil
+	}
+	if te.Task.Namespace == "" {
+		te.Task.Namespace = ns
+		return nil
+	}
+	if te.Task.Namespace != ns {
+		return &ValidationError{Errors: []FieldError{{
+			Field:   "task.namespace",
+			Message: fmt.Sprintf("must match the namespace %q in the path", ns),
+		}}}
+	}
+	return nil
+}
+
+// scopeTask hides tasks outside the namespace of a namespaced route.
+func (a *Api) scopeTask(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ns := chi.URLParam(r, "namespace")
+		if ns == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+		if err != nil {
+			a.Logger.Printf("failed to parse task id from the request: %v\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if t, ok := a.Manager.GetTask(tID); !ok || t.Namespace != ns {
+			a.Logger.Printf("task %v not found in namespace %s.\n", tID, ns)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type PrePullRequest struct {
+	Images []string
+	Nodes  []string
+}
+
+func (a *Api) PrePullImagesHandler(w http.ResponseWriter, r *http.Request) {
+	var req PrePullRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		msg := "failed to decode the request body"
+		a.Logger.Printf("%s: %v", msg, err)
+		json.NewEncoder(w).Encode(
+			ErrorResponse{
+				HTTPStatusCode: http.StatusBadRequest,
+				Message:        msg,
+			})
+		return
+	}
+
+	if err := a.Manager.PrePullImages(req.Images, req.Nodes); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		a.Logger.Printf("failed to pre-pull images: %v", err)
+		json.NewEncoder(w).Encode(
+			ErrorResponse{
+				HTTPStatusCode: http.StatusNotFound,
+				Message:        err.Error(),
+			})
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *Api) GetNodesHandler(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(a.Manager.GetNodes())
+}
+
+type RegisterRequest struct {
+	Name   string
+	CSR    string
+	Labels map[string]string
+	Taints []node.Taint
+}
+
+type RegisterResponse struct {
+	Name        string
+	Certificate string
+	CA          string
+}
+
+// RegisterNodeHandler adds a worker to the cluster. When the manager runs a
+// CA and an authenticated request carries a certificate request, the worker
+// is issued a certificate for its host, which must be the host the request
+// comes from.
+func (a *Api) RegisterNodeHandler(w http.ResponseWriter, r *http.Request) {
+	var req RegisterRequest
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&req); err != nil {
+		msg := fmt.Sprintf("failed to decode the request body: %v", err)
+		a.Logger.Println(msg)
+		a.writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if !a.allowedAsNode(w, r, req.Name) {
+		return
+	}
+
+	host, _, err := net.SplitHostPort(req.Name)
+	if err != nil {
+		msg := fmt.Sprintf("node name must be host:port: %v", err)
+		a.Logger.Println(msg)
+		a.writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := node.ValidateLabels(req.Labels); err != nil {
+		a.Logger.Printf("rejected registration of node %s: %v\n", req.Name, err)
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := node.ValidateTaints(req.Taints); err != nil {
+		a.Logger.Printf("rejected registration of node %s: %v\n", req.Name, err)
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := RegisterResponse{Name: req.Name}
+	if req.CSR != "" && a.CA != nil {
+		if _, ok := auth.PrincipalFrom(r.Context()); !ok {
+			a.Logger.Printf("refused to issue a certificate to node %s: request is not authenticated\n", req.Name)
+			a.writeError(w, http.StatusUnauthorized, "certificates are only issued to authenticated requests")
+			return
+		}
+		if !hostMatchesRemote(host, r.RemoteAddr) {
+			msg := fmt.Sprintf("node host %s does not match the request address %s", host, r.RemoteAddr)
+			a.Logger.Printf("refused to issue a certificate to node %s: %s\n", req.Name, msg)
+			a.writeError(w, http.StatusForbidden, msg)
+			return
+		}
+
+		cert, err := a.CA.SignCSR([]byte(req.CSR), pkix.Name{
+			CommonName:   req.Name,
+			Organization: []string{auth.GroupWorkers},
+		}, []string{host})
+		if err != nil {
+			a.Logger.Printf("failed to issue a certificate to node %s: %v\n", req.Name, err)
+			a.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		resp.Certificate = string(cert)
+		resp.CA = string(a.CA.CertPEM)
+		a.Logger.Printf("issued certificate to node %s\n", req.Name)
+	}
+
+	status := http.StatusOK
+	if a.Manager.RegisterNode(req.Name, req.Labels, req.Taints) {
+		a.Logger.Printf("registered node %s\n", req.Name)
+		status = http.StatusCreated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// SetNodeLabelsHandler replaces the labels of the node in the path with the
+// labels in the request body.
+func (a *Api) SetNodeLabelsHandler(w http.ResponseWriter, r *http.Request) {
+	var labels map[string]string
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&labels); err != nil {
+		msg := fmt.Sprintf("failed to decode the request body: %v", err)
+		a.Logger.Println(msg)
+		a.writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	n, err := a.Manager.SetNodeLabels(chi.URLParam(r, "name"), labels)
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		a.writeError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	a.Logger.Printf("set labels of node %s to %v\n", n.Name, n.Labels)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n)
+}
+
+// SetNodeTaintsHandler replaces the taints of the node in the path with the
+// taints in the request body, evicting tasks that do not tolerate a new
+// NoExecute taint.
+func (a *Api) SetNodeTaintsHandler(w http.ResponseWriter, r *http.Request) {
+	var taints []node.Taint
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&taints); err != nil {
+		msg := fmt.Sprintf("failed to decode the request body: %v", err)
+		a.Logger.Println(msg)
+		a.writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	n, err := a.Manager.SetNodeTaints(chi.URLParam(r, "name"), taints)
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		a.writeError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	a.Logger.Printf("set taints of node %s to %v\n", n.Name, n.Taints)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n)
+}
+
+// hostMatchesRemote reports whether host, an IP address or a name, is the
+// address of the remote end of a request.
+func hostMatchesRemote(host, remoteAddr string) bool {
+	remote, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	remoteIP := net.ParseIP(remote)
+	if remoteIP == nil {
+		return false
+	}
+
+	addrs := []string{host}
+	if net.ParseIP(host) == nil {
+		addrs, err = net.LookupHost(host)
+		if err != nil {
+			return false
+		}
+	}
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ip.Equal(remoteIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetQuotaHandler reports the quota and usage of the namespace in the path,
+// or of every namespace.
+func (a *Api) GetQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if ns := chi.URLParam(r, "namespace"); ns != "" {
+		json.NewEncoder(w).Encode(a.Manager.GetQuotaStatus(ns))
+		return
+	}
+	json.NewEncoder(w).Encode(a.Manager.GetQuotaStatuses())
+}
+
+// MetricsHandler exposes the queue of every namespace and the count of
+// rejected task reports in the Prometheus text format.
+func (a *Api) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := a.Manager.QueueStats()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP cube_queue_depth Task events waiting to be dispatched.")
+	fmt.Fprintln(w, "# TYPE cube_queue_depth gauge")
+	for _, s := range stats {
+		fmt.Fprintf(w, "cube_queue_depth{namespace=%q} %d\n", s.Namespace, s.Depth)
+	}
+	fmt.Fprintln(w, "# HELP cube_queue_weight Fair share weight of the namespace.")
+	fmt.Fprintln(w, "# TYPE cube_queue_weight gauge")
+	for _, s := range stats {
+		fmt.Fprintf(w, "cube_queue_weight{namespace=%q} %g\n", s.Namespace, s.Weight)
+	}
+	fmt.Fprintln(w, "# HELP cube_queue_dispatched_total Task events dispatched from the queue.")
+	fmt.Fprintln(w, "# TYPE cube_queue_dispatched_total counter")
+	for _, s := range stats {
+		fmt.Fprintf(w, "cube_queue_dispatched_total{namespace=%q} %d\n", s.Namespace, s.Dispatched)
+	}
+	fmt.Fprintln(w, "# HELP cube_task_reports_rejected_total Task reports from workers that were ignored.")
+	fmt.Fprintln(w, "# TYPE cube_task_reports_rejected_total counter")
+	fmt.Fprintf(w, "cube_task_reports_rejected_total %d\n", a.Manager.RejectedReports())
+}
+
+func (a *Api) GetTaskEventsHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		a.Logger.Printf("failed to parse task id from the request: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	history, ok := a.Manager.GetTaskHistory(tID)
+	if !ok {
+		a.Logger.Printf("task %v not found.\n", tID)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// WatchHandler streams task and node changes as server-sent events. Clients
+// resume after a reconnect by passing the last revision they received, either
+// as the revision query parameter or the Last-Event-ID header. Under
+// /namespaces/{namespace}, or with the namespace parameter, only that
+// namespace's tasks are streamed.
+func (a *Api) WatchHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(
+			ErrorResponse{
+				HTTPStatusCode: http.StatusInternalServerError,
+				Message:        "streaming is not supported",
+			})
+		return
+	}
+
+	revision := int64(-1)
+	last := r.URL.Query().Get("revision")
+	if last == "" {
+		last = r.Header.Get("Last-Event-ID")
+	}
+	if last != "" {
+		rev, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || rev < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(
+				ErrorResponse{
+					HTTPStatusCode: http.StatusBadRequest,
+					Message:        fmt.Sprintf("invalid revision %q", last),
+				})
+			return
+		}
+		revision = rev
+	}
+	kind := r.URL.Query().Get("kind")
+	ns := chi.URLParam(r, "namespace")
+	if ns == "" {
+		ns = r.URL.Query().Get("namespace")
+	}
+
+	backlog, events, err := a.Manager.Watcher.Subscribe(revision)
+	if err != nil {
+		w.WriteHeader(http.StatusGone)
+		json.NewEncoder(w).Encode(
+			ErrorResponse{
+				HTTPStatusCode: http.StatusGone,
+				Message:        err.Error(),
+			})
+		return
+	}
+	defer a.Manager.Watcher.Unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, e := range backlog {
+		if err := writeWatchEvent(w, e, kind, ns); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := writeWatchEvent(w, e, kind, ns); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeWatchEvent writes e unless it is filtered out by kind or namespace.
+// Nodes belong to no namespace, so a namespaced watch only sees tasks.
+func writeWatchEvent(w io.Writer, e WatchEvent, kind string, ns string) error {
+	if kind != "" && e.Kind != kind {
+		return nil
+	}
+	if ns != "" && (e.Task == nil || e.Task.Namespace != ns) {
+		return nil
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Revision, e.Kind, data)
+	return err
+}
+
+func (a *Api) taskRoutes(r chi.Router) {
+	r.With(a.authorize(auth.VerbCreate, "tasks")).Post("/", a.StartTaskHandler)
+	r.With(a.authorize(auth.VerbList, "tasks")).Get("/", a.GetTasksHandler)
+	r.With(a.authorize(auth.VerbDelete, "tasks")).Delete("/", a.StopTasksHandler)
+	r.Route("/{taskID}", func(r chi.Router) {
+		r.With(a.authorize(auth.VerbGet, "tasks"), a.scopeTask).Get("/", a.GetTaskHandler)
+		r.With(a.authorize(auth.VerbDelete, "tasks"), a.scopeTask).Delete("/", a.StopTaskHandler)
+		r.With(a.authorize(auth.VerbUpdate, "tasks"), a.scopeTask).Patch("/", a.PatchTaskHandler)
+		r.With(a.authorize(auth.VerbGet, "tasks"), a.scopeTask).Get("/events", a.GetTaskEventsHandler)
+	})
+}
+
 func (a *Api) initRouter() {
 	a.Router = chi.NewRouter()
-	a.Router.Route("/tasks", func(r chi.Router) {
-		r.Post("/", a.StartTaskHandler)
-		r.Get("/", a.GetTasksHandler)
-		r.Route("/{taskID}", func(r chi.Router) {
-			r.Delete("/", a.StopTaskHandler)
+	if a.Auth != nil {
+		a.Router.Use(a.Auth.Middleware)
+	}
+	a.Router.Route("/tasks", a.taskRoutes)
+	a.Router.With(a.authorize(auth.VerbCreate, "tasks")).Post("/tasks:batch", a.StartTaskBatchHandler)
+
+	a.Router.Route("/namespaces/{namespace}", func(r chi.Router) {
+		r.Route("/tasks", a.taskRoutes)
+		r.With(a.authorize(auth.VerbCreate, "tasks")).Post("/tasks:batch", a.StartTaskBatchHandler)
+		r.With(a.authorize(auth.VerbGet, "quotas")).Get("/quota", a.GetQuotaHandler)
+		r.With(a.authorize(auth.VerbWatch, "tasks")).Get("/watch", a.WatchHandler)
+	})
+
+	a.Router.With(a.authorize(auth.VerbList, "quotas")).Get("/quotas", a.GetQuotaHandler)
+
+	a.Router.Route("/images", func(r chi.Router) {
+		r.With(a.authorize(auth.VerbCreate, "images")).Post("/", a.PrePullImagesHandler)
+	})
+
+	a.Router.Route("/nodes", func(r chi.Router) {
+		r.With(a.authorize(auth.VerbList, "nodes")).Get("/", a.GetNodesHandler)
+		r.With(a.authorize(auth.VerbCreate, "nodes")).Post("/", a.RegisterNodeHandler)
+		r.Route("/{name}", func(r chi.Router) {
+			r.Use(a.selfNode)
+			r.With(a.authorize(auth.VerbUpdate, "nodes")).Put("/labels", a.SetNodeLabelsHandler)
+			r.With(a.authorize(auth.VerbUpdate, "nodes")).Put("/taints", a.SetNodeTaintsHandler)
+			r.With(a.authorize(auth.VerbUpdate, "nodes/tasks")).Post("/tasks", a.ReportTasksHandler)
 		})
 	})
+
+	a.Router.With(a.authorize(auth.VerbWatch, "tasks")).Get("/watch", a.WatchHandler)
+	a.Router.With(a.authorize(auth.VerbGet, "metrics")).Get("/metrics", a.MetricsHandler)
 }
 
 func (a *Api) Start() {
@@ -130,7 +929,19 @@ func (a *Api) Start() {
 	a.Logger.Printf("attempting to start the manager: %s:%d\n", a.Address, a.Port)
 
 	go func() {
-		if err := http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router); err != nil {
+		srv := &http.Server{
+			Addr:      fmt.Sprintf("%s:%d", a.Address, a.Port),
+			Handler:   a.Router,
+			TLSConfig: a.TLSConfig,
+		}
+
+		var err error
+		if a.TLSConfig != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
 			a.Logger.Printf("failed to start the worker api: %v", err)
 		}
 	}()
@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/reversearrow/orchestrator/auth"
+)
+
+// authorize returns middleware that lets a request through only if the RBAC
+// policy allows its principal the verb on the resource, in the namespace of
+// namespaced routes. Without a policy every request is allowed.
+func (a *Api) authorize(verb, resource string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if a.Policy == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			p, ok := auth.PrincipalFrom(r.Context())
+			if !ok {
+				p = auth.Principal{Name: auth.Anonymous, Groups: []string{auth.GroupUnauthenticated}}
+			} else {
+				p.Groups = append(append([]string(nil), p.Groups...), auth.GroupAuthenticated)
+			}
+
+			ns := chi.URLParam(r, "namespace")
+			if !a.Policy.Allowed(p, verb, resource, ns) {
+				a.Audit.Printf("audit: denied user=%q groups=%q verb=%s resource=%s namespace=%q method=%s path=%s remote=%s\n",
+					p.Name, p.Groups, verb, resource, ns, r.Method, r.URL.Path, r.RemoteAddr)
+				msg := fmt.Sprintf("forbidden: %s cannot %s %s", p.Name, verb, resource)
+				if ns != "" {
+					msg += " in namespace " + ns
+				}
+				a.writeError(w, http.StatusForbidden, msg)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// selfNode lets a worker act only on its own node: a principal in the
+// workers group must be named after the node in the path.
+func (a *Api) selfNode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.allowedAsNode(w, r, chi.URLParam(r, "name")) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedAsNode reports whether the request's principal may act as the named
+// node, writing a 403 if not.
+func (a *Api) allowedAsNode(w http.ResponseWriter, r *http.Request, name string) bool {
+	p, ok := auth.PrincipalFrom(r.Context())
+	if !ok || !slices.Contains(p.Groups, auth.GroupWorkers) || p.Name == name {
+		return true
+	}
+
+	a.Audit.Printf("audit: denied user=%q groups=%q node=%q method=%s path=%s remote=%s\n",
+		p.Name, p.Groups, name, r.Method, r.URL.Path, r.RemoteAddr)
+	a.writeError(w, http.StatusForbidden, fmt.Sprintf("forbidden: %s cannot act as node %s", p.Name, name))
+	return false
+}
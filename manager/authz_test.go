@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/auth"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+// newAuthTestApi returns an api whose tokens are named after themselves and
+// put workers named host:port in the workers group.
+func newAuthTestApi(t *testing.T, m *Manager, tokens ...string) *Api {
+	t.Helper()
+
+	var ts []auth.Token
+	for _, tok := range tokens {
+		ts = append(ts, auth.Token{Token: tok, Name: tok, Groups: []string{auth.GroupWorkers}})
+	}
+	a, err := NewApi(log.New(io.Discard, "", 0), m, "localhost", 5556)
+	if err != nil {
+		t.Fatalf("NewApi: %v", err)
+	}
+	if len(ts) > 0 {
+		a.Auth, err = auth.NewAuthenticator(a.Logger, ts)
+		if err != nil {
+			t.Fatalf("NewAuthenticator: %v", err)
+		}
+	}
+	a.initRouter()
+	return a
+}
+
+func TestRegisterNodeCertificate(t *testing.T) {
+	ca, _, err := auth.NewCA("test-ca")
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	csr, _, err := auth.NewCSR("ignored", nil)
+	if err != nil {
+		t.Fatalf("NewCSR: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		noAuth bool
+		token  string
+		node   string
+		remote string
+		want   int
+	}{
+		{name: "own node from its host", token: "10.0.0.5:5555", node: "10.0.0.5:5555", remote: "10.0.0.5:40000", want: http.StatusCreated},
+		{name: "own node from another host", token: "10.0.0.5:5555", node: "10.0.0.5:5555", remote: "10.0.0.9:40000", want: http.StatusForbidden},
+		{name: "another node", token: "10.0.0.5:5555", node: "10.0.0.6:5555", remote: "10.0.0.6:40000", want: http.StatusForbidden},
+		{name: "no credentials", node: "10.0.0.5:5555", remote: "10.0.0.5:40000", want: http.StatusUnauthorized},
+		{name: "authentication disabled", noAuth: true, node: "10.0.0.5:5555", remote: "10.0.0.5:40000", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a *Api
+			if tt.noAuth {
+				a = newAuthTestApi(t, newTestManager(t))
+			} else {
+				a = newAuthTestApi(t, newTestManager(t), "10.0.0.5:5555")
+			}
+			a.CA = ca
+
+			body, _ := json.Marshal(RegisterRequest{Name: tt.node, CSR: string(csr)})
+			r := httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(body))
+			r.RemoteAddr = tt.remote
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			a.Router.ServeHTTP(rec, r)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			registered := a.Manager.getNode(tt.node) != nil
+			if registered != (tt.want == http.StatusCreated) {
+				t.Errorf("node registered = %v", registered)
+			}
+			if tt.want != http.StatusCreated {
+				return
+			}
+			var resp RegisterResponse
+			json.NewDecoder(rec.Body).Decode(&resp)
+			if resp.Certificate == "" || resp.CA != string(ca.CertPEM) {
+				t.Errorf("no certificate issued")
+			}
+		})
+	}
+}
+
+func TestReportAsNode(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		path     string
+		owner    string
+		want     int
+		wantUp   bool
+		rejected uint64
+	}{
+		{name: "own task", token: "w1:5555", path: "w1:5555", owner: "w1:5555", want: http.StatusNoContent, wantUp: true},
+		{name: "as another node", token: "w1:5555", path: "w2:5555", owner: "w2:5555", want: http.StatusForbidden},
+		{name: "another node's task", token: "w1:5555", path: "w1:5555", owner: "w2:5555", want: http.StatusNoContent, rejected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			a := newAuthTestApi(t, m, "w1:5555", "w2:5555")
+
+			v := &task.Task{ID: uuid.New(), Namespace: task.DefaultNamespace, State: task.Scheduled}
+			m.TaskDb[v.ID] = v
+			m.TaskWorkerMap[v.ID] = tt.owner
+			m.WorkerTaskMap[tt.owner] = []uuid.UUID{v.ID}
+
+			report := *v
+			report.State = task.Running
+			report.ContainerID = "c1"
+			body, _ := json.Marshal([]task.Task{report})
+			r := httptest.NewRequest(http.MethodPost, "/nodes/"+tt.path+"/tasks", bytes.NewReader(body))
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			a.Router.ServeHTTP(rec, r)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if up := v.State == task.Running; up != tt.wantUp {
+				t.Errorf("task state = %v, report applied = %v, want %v", v.State, up, tt.wantUp)
+			}
+			if got := m.RejectedReports(); got != tt.rejected {
+				t.Errorf("RejectedReports() = %d, want %d", got, tt.rejected)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+const maxBatchSize = 1000
+
+type BatchItemResult struct {
+	Index      int          `json:"index"`
+	TaskID     uuid.UUID    `json:"taskId,omitempty"`
+	StatusCode int          `json:"status"`
+	Error      string       `json:"error,omitempty"`
+	Errors     []FieldError `json:"errors,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []BatchItemResult `json:"results"`
+}
+
+// DecodeTaskEventBatch decodes a batch submission of the form
+// {"events": [<TaskEvent>, ...]}. Every event is decoded on its own, so that
+// a malformed event is reported against its index rather than failing the
+// whole body.
+func DecodeTaskEventBatch(r io.Reader) ([]task.TaskEvent, []error, error) {
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+
+	var body struct {
+		Events []json.RawMessage `json:"events"`
+	}
+	if err := d.Decode(&body); err != nil {
+		return nil, nil, err
+	}
+	if len(body.Events) == 0 {
+		return nil, nil, fmt.Errorf("batch has no events")
+	}
+	if len(body.Events) > maxBatchSize {
+		return nil, nil, fmt.Errorf("batch has %d events, the maximum is %d", len(body.Events), maxBatchSize)
+	}
+
+	events := make([]task.TaskEvent, len(body.Events))
+	errs := make([]error, len(body.Events))
+	for i, raw := range body.Events {
+		events[i], errs[i] = task.DecodeTaskEvent(bytes.NewReader(raw))
+	}
+	return events, errs, nil
+}
+
+// AddTaskBatch enqueues every event or, if any of them already failed
+// admission or clashes with another task, none of them. The returned slice
+// holds the error for each event, if any.
+func (m *Manager) AddTaskBatch(events []task.TaskEvent, errs []error) ([]error, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if errs == nil {
+		errs = make([]error, len(events))
+	}
+
+	ok := true
+	seen := make(map[uuid.UUID]int, len(events))
+	names := make(map[string]int, len(events))
+	pending := make(map[string]QuotaUsage)
+	for i, te := range events {
+		if errs[i] != nil {
+			ok = false
+			continue
+		}
+
+		var err error
+		if j, dup := seen[te.Task.ID]; dup {
+			err = fmt.Errorf("%w: task id %v is also used by event %d", ErrInvalidTask, te.Task.ID, j)
+		} else if _, exists := m.TaskDb[te.Task.ID]; exists {
+			err = fmt.Errorf("%w: %v", ErrTaskExists, te.Task.ID)
+		} else if j, dup := names[te.Task.Namespace+"/"+te.Task.Name]; dup && te.Task.Name != "" {
+			err = fmt.Errorf("%w: %q in namespace %q is also used by event %d", ErrNameConflict, te.Task.Name, te.Task.Namespace, j)
+		} else if err = m.checkName(te.Task); err == nil {
+			p := pending[te.Task.Namespace]
+			if err = m.checkQuota(nil, te.Task, p); err == nil {
+				p.add(te.Task)
+				pending[te.Task.Namespace] = p
+			}
+		}
+		seen[te.Task.ID] = i
+		names[te.Task.Namespace+"/"+te.Task.Name] = i
+
+		if err != nil {
+			errs[i] = err
+			ok = false
+		}
+	}
+
+	if !ok {
+		return errs, false
+	}
+
+	for _, te := range events {
+		m.addTasks(te)
+	}
+	return errs, true
+}
+
+// StopTasks stops every task in namespace, or in any namespace if it is
+// empty, whose labels match sel. Tasks already in a terminal state are
+// skipped.
+func (m *Manager) StopTasks(namespace string, sel task.Selector) []BatchItemResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []uuid.UUID
+	for id, t := range m.TaskDb {
+		if task.IsTerminal(t.State) || !sel.Matches(t.Labels) {
+			continue
+		}
+		if namespace != "" && t.Namespace != namespace {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+
+	results := make([]BatchItemResult, 0, len(ids))
+	for i, id := range ids {
+		r := BatchItemResult{
+			Index:      i,
+			TaskID:     id,
+			StatusCode: http.StatusNoContent,
+		}
+		if err := m.stopTaskLocked(id); err != nil {
+			r.StatusCode = http.StatusConflict
+			r.Error = err.Error()
+		}
+		results = append(results, r)
+	}
+	return results
+}
@@ -0,0 +1,160 @@
+package manager
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reversearrow/orchestrator/task"
+)
+
+// FairQueue shares dispatch between namespaces in proportion to their
+// weights, so that a namespace with a large backlog does not hold up the
+// others. Within a namespace events keep the TaskQueue order. Stop and update
+// events for placed tasks bypass the fair share. The zero value is an empty
+// queue in which every namespace has weight 1.
+//
+// Each namespace has a pass value that grows by 1/weight with every event it
+// dispatches, and the namespace with the lowest pass goes next. A namespace
+// that becomes active again starts at the current virtual time instead of
+// the pass it had when it went idle, so idling does not build up credit.
+type FairQueue struct {
+	Weights map[string]float64
+
+	control TaskQueue
+	tenants map[string]*tenantQueue
+	vtime   float64
+}
+
+type tenantQueue struct {
+	queue      TaskQueue
+	pass       float64
+	dispatched uint64
+}
+
+type TenantQueueStats struct {
+	Namespace  string
+	Weight     float64
+	Depth      int
+	Dispatched uint64
+}
+
+func (q *FairQueue) Enqueue(te task.TaskEvent) {
+	if isControlEvent(te) {
+		q.control.Enqueue(te)
+		return
+	}
+	q.tenant(te).queue.Enqueue(te)
+}
+
+func (q *FairQueue) EnqueueAfter(te task.TaskEvent, d time.Duration) {
+	if isControlEvent(te) {
+		q.control.EnqueueAfter(te, d)
+		return
+	}
+	q.tenant(te).queue.EnqueueAfter(te, d)
+}
+
+func (q *FairQueue) Dequeue() (task.TaskEvent, bool) {
+	if te, ok := q.control.Dequeue(); ok {
+		return te, true
+	}
+
+	var next string
+	var nextQueue *tenantQueue
+	for ns, tq := range q.tenants {
+		if !tq.queue.Ready() {
+			continue
+		}
+		if nextQueue == nil || tq.pass < nextQueue.pass || (tq.pass == nextQueue.pass && ns < next) {
+			next, nextQueue = ns, tq
+		}
+	}
+	if nextQueue == nil {
+		return task.TaskEvent{}, false
+	}
+
+	te, _ := nextQueue.queue.Dequeue()
+	q.vtime = nextQueue.pass
+	nextQueue.pass += 1 / q.weight(next)
+	nextQueue.dispatched++
+	return te, true
+}
+
+func (q *FairQueue) Len() int {
+	n := q.control.Len()
+	for _, tq := range q.tenants {
+		n += tq.queue.Len()
+	}
+	return n
+}
+
+// Stats reports the queue of every namespace that has queued events or has
+// dispatched any.
+func (q *FairQueue) Stats() []TenantQueueStats {
+	stats := make([]TenantQueueStats, 0, len(q.tenants))
+	for ns, tq := range q.tenants {
+		stats = append(stats, TenantQueueStats{
+			Namespace:  ns,
+			Weight:     q.weight(ns),
+			Depth:      tq.queue.Len(),
+			Dispatched: tq.dispatched,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Namespace < stats[j].Namespace
+	})
+	return stats
+}
+
+func (q *FairQueue) tenant(te task.TaskEvent) *tenantQueue {
+	ns := te.Task.Namespace
+	if ns == "" {
+		ns = task.DefaultNamespace
+	}
+
+	if q.tenants == nil {
+		q.tenants = make(map[string]*tenantQueue)
+	}
+	tq, ok := q.tenants[ns]
+	if !ok {
+		tq = &tenantQueue{}
+		q.tenants[ns] = tq
+	}
+	if tq.queue.Len() == 0 && tq.pass < q.vtime {
+		tq.pass = q.vtime
+	}
+	return tq
+}
+
+func (q *FairQueue) weight(ns string) float64 {
+	if w := q.Weights[ns]; w > 0 {
+		return w
+	}
+	return 1
+}
+
+// ParseQueueWeights reads weights in the form "team-a=3,team-b=0.5".
+func ParseQueueWeights(s string) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		ns, value, ok := strings.Cut(part, "=")
+		if !ok || !namespacePattern.MatchString(ns) {
+			return nil, fmt.Errorf("invalid queue weight %q, expected namespace=weight", part)
+		}
+		w, err := strconv.ParseFloat(value, 64)
+		if err != nil || w <= 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("invalid queue weight %q, expected a positive number", part)
+		}
+		weights[ns] = w
+	}
+	return weights, nil
+}
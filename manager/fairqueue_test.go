@@ -0,0 +1,135 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/reversearrow/orchestrator/task"
+)
+
+func tenantEvent(ns string, state task.State) task.TaskEvent {
+	te := testEvent(ns, state, 0)
+	te.Task.Namespace = ns
+	return te
+}
+
+func TestFairQueueOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]float64
+		events  []task.TaskEvent
+		want    string
+	}{
+		{
+			name: "equal weights alternate",
+			events: []task.TaskEvent{
+				tenantEvent("a", task.Pending), tenantEvent("a", task.Pending), tenantEvent("a", task.Pending),
+				tenantEvent("b", task.Pending), tenantEvent("b", task.Pending),
+			},
+			want: "ababa",
+		},
+		{
+			name:    "weights share dispatch",
+			weights: map[string]float64{"b": 2},
+			events: []task.TaskEvent{
+				tenantEvent("a", task.Pending), tenantEvent("a", task.Pending), tenantEvent("a", task.Pending),
+				tenantEvent("b", task.Pending), tenantEvent("b", task.Pending), tenantEvent("b", task.Pending),
+				tenantEvent("b", task.Pending), tenantEvent("b", task.Pending), tenantEvent("b", task.Pending),
+			},
+			want: "abbabbabb",
+		},
+		{
+			name: "control events go first",
+			events: []task.TaskEvent{
+				tenantEvent("a", task.Pending), tenantEvent("b", task.Pending),
+				tenantEvent("c", task.Stopping), tenantEvent("c", task.Restarting),
+			},
+			want: "ccab",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &FairQueue{Weights: tt.weights}
+			for _, te := range tt.events {
+				q.Enqueue(te)
+			}
+			if q.Len() != len(tt.events) {
+				t.Errorf("Len() = %d, want %d", q.Len(), len(tt.events))
+			}
+			if got := strings.Join(drain(q), ""); got != tt.want {
+				t.Errorf("dequeued %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFairQueueIdleTenant(t *testing.T) {
+	q := &FairQueue{}
+	for i := 0; i < 4; i++ {
+		q.Enqueue(tenantEvent("a", task.Pending))
+	}
+	for i := 0; i < 3; i++ {
+		q.Dequeue()
+	}
+
+	// b was idle while a dispatched, so it starts at the current virtual
+	// time instead of draining its backlog ahead of a.
+	q.Enqueue(tenantEvent("b", task.Pending))
+	q.Enqueue(tenantEvent("b", task.Pending))
+	q.Enqueue(tenantEvent("a", task.Pending))
+	if got := strings.Join(drain(q), ""); got != "baba" {
+		t.Errorf("dequeued %q, want %q", got, "baba")
+	}
+
+	want := []TenantQueueStats{
+		{Namespace: "a", Weight: 1, Dispatched: 5},
+		{Namespace: "b", Weight: 1, Dispatched: 2},
+	}
+	stats := q.Stats()
+	if len(stats) != len(want) {
+		t.Fatalf("Stats() = %+v, want %+v", stats, want)
+	}
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("Stats()[%d] = %+v, want %+v", i, stats[i], want[i])
+		}
+	}
+}
+
+func TestParseQueueWeights(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{in: "", want: map[string]float64{}},
+		{in: "team-a=3, team-b=0.5,", want: map[string]float64{"team-a": 3, "team-b": 0.5}},
+		{in: "team-a", wantErr: true},
+		{in: "team-a=0", wantErr: true},
+		{in: "team-a=-1", wantErr: true},
+		{in: "team-a=x", wantErr: true},
+		{in: "team-a=NaN", wantErr: true},
+		{in: "team-a=Inf", wantErr: true},
+		{in: "team-a=+Inf", wantErr: true},
+		{in: "team-a=1e400", wantErr: true},
+		{in: "Team_A=1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseQueueWeights(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseQueueWeights(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseQueueWeights(%q) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for ns, w := range tt.want {
+			if got[ns] != w {
+				t.Errorf("ParseQueueWeights(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		}
+	}
+}
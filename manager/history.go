@@ -0,0 +1,100 @@
+package manager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+const (
+	SourceApi       = "api"
+	SourceScheduler = "scheduler"
+	SourceWorker    = "worker"
+	SourceManager   = "manager"
+)
+
+type HistoryEntry struct {
+	TaskID    uuid.UUID  `json:"taskId"`
+	From      task.State `json:"from"`
+	To        task.State `json:"to"`
+	Source    string     `json:"source"`
+	Reason    string     `json:"reason,omitempty"`
+	Worker    string     `json:"worker,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Timestamp time.Time  `json:"timestamp"`
+}
+
+// History is an append-only log of task state transitions. Entries older than
+// MaxAge are dropped, and each task keeps at most MaxPerTask entries.
+type History struct {
+	MaxPerTask int
+	MaxAge     time.Duration
+
+	mu         sync.RWMutex
+	entries    map[uuid.UUID][]HistoryEntry
+	lastExpire time.Time
+}
+
+func NewHistory(maxPerTask int, maxAge time.Duration) *History {
+	return &History{
+		MaxPerTask: maxPerTask,
+		MaxAge:     maxAge,
+		entries:    make(map[uuid.UUID][]HistoryEntry),
+	}
+}
+
+func (h *History) Append(e HistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := append(h.entries[e.TaskID], e)
+	if h.MaxPerTask > 0 && len(entries) > h.MaxPerTask {
+		entries = entries[len(entries)-h.MaxPerTask:]
+	}
+	h.entries[e.TaskID] = entries
+	h.expire(e.Timestamp)
+}
+
+func (h *History) Get(id uuid.UUID) []HistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var entries []HistoryEntry
+	cutoff := h.cutoff(time.Now().UTC())
+	for _, e := range h.entries[id] {
+		if e.Timestamp.Before(cutoff) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func (h *History) expire(now time.Time) {
+	if h.MaxAge <= 0 || now.Sub(h.lastExpire) < time.Minute {
+		return
+	}
+	h.lastExpire = now
+
+	cutoff := h.cutoff(now)
+	for id, entries := range h.entries {
+		i := 0
+		for i < len(entries) && entries[i].Timestamp.Before(cutoff) {
+			i++
+		}
+		if i == len(entries) {
+			delete(h.entries, id)
+			continue
+		}
+		h.entries[id] = entries[i:]
+	}
+}
+
+func (h *History) cutoff(now time.Time) time.Time {
+	if h.MaxAge <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-h.MaxAge)
+}
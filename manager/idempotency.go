@@ -0,0 +1,106 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+)
+
+const defaultIdempotencyWindow = 24 * time.Hour
+
+var (
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+	ErrRequestInProgress    = errors.New("a request with this idempotency key is in progress")
+)
+
+type IdempotentResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+type idempotencyEntry struct {
+	fingerprint [sha256.Size]byte
+	response    *IdempotentResponse
+	expires     time.Time
+}
+
+// IdempotencyCache remembers the response to each request carrying an
+// idempotency key for Window, so that a retried request gets the original
+// response instead of being applied twice.
+type IdempotencyCache struct {
+	Window time.Duration
+
+	mu         sync.Mutex
+	entries    map[string]*idempotencyEntry
+	lastExpire time.Time
+}
+
+func NewIdempotencyCache(window time.Duration) *IdempotencyCache {
+	return &IdempotencyCache{
+		Window:  window,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// Begin claims key for a request with the given body. It returns the stored
+// response when the request was already completed, or nil when the caller
+// should process the request and then call Complete or Abort.
+func (c *IdempotencyCache) Begin(key string, body []byte) (*IdempotentResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.expire(now)
+
+	fingerprint := sha256.Sum256(body)
+	if e, ok := c.entries[key]; ok && now.Before(e.expires) {
+		if e.fingerprint != fingerprint {
+			return nil, ErrIdempotencyKeyReused
+		}
+		if e.response == nil {
+			return nil, ErrRequestInProgress
+		}
+		return e.response, nil
+	}
+
+	c.entries[key] = &idempotencyEntry{
+		fingerprint: fingerprint,
+		expires:     now.Add(c.Window),
+	}
+	return nil, nil
+}
+
+func (c *IdempotencyCache) Complete(key string, statusCode int, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.response = &IdempotentResponse{
+			StatusCode: statusCode,
+			Body:       body,
+		}
+	}
+}
+
+// Abort releases key without storing a response, so the request can be
+// retried, for example after it was rejected.
+func (c *IdempotencyCache) Abort(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+func (c *IdempotencyCache) expire(now time.Time) {
+	if now.Sub(c.lastExpire) < time.Minute {
+		return
+	}
+	c.lastExpire = now
+
+	for key, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
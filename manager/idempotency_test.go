@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyCache(t *testing.T) {
+	type step struct {
+		action   string // begin, complete or abort
+		key      string
+		body     string
+		wantResp bool
+		wantErr  error
+	}
+	tests := []struct {
+		name   string
+		window time.Duration
+		steps  []step
+	}{
+		{
+			name:   "replay completed request",
+			window: time.Hour,
+			steps: []step{
+				{action: "begin", key: "k", body: "a"},
+				{action: "complete", key: "k"},
+				{action: "begin", key: "k", body: "a", wantResp: true},
+			},
+		},
+		{
+			name:   "request in progress",
+			window: time.Hour,
+			steps: []step{
+				{action: "begin", key: "k", body: "a"},
+				{action: "begin", key: "k", body: "a", wantErr: ErrRequestInProgress},
+			},
+		},
+		{
+			name:   "key reused with another body",
+			window: time.Hour,
+			steps: []step{
+				{action: "begin", key: "k", body: "a"},
+				{action: "complete", key: "k"},
+				{action: "begin", key: "k", body: "b", wantErr: ErrIdempotencyKeyReused},
+			},
+		},
+		{
+			name:   "aborted request can be retried",
+			window: time.Hour,
+			steps: []step{
+				{action: "begin", key: "k", body: "a"},
+				{action: "abort", key: "k"},
+				{action: "begin", key: "k", body: "b"},
+			},
+		},
+		{
+			name:   "keys are independent",
+			window: time.Hour,
+			steps: []step{
+				{action: "begin", key: "k1", body: "a"},
+				{action: "begin", key: "k2", body: "a"},
+			},
+		},
+		{
+			name:   "expired key is claimed again",
+			window: time.Nanosecond,
+			steps: []step{
+				{action: "begin", key: "k", body: "a"},
+				{action: "complete", key: "k"},
+				{action: "begin", key: "k", body: "b"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewIdempotencyCache(tt.window)
+			for i, s := range tt.steps {
+				switch s.action {
+				case "complete":
+					c.Complete(s.key, 201, []byte("created"))
+				case "abort":
+					c.Abort(s.key)
+				case "begin":
+					if tt.window < time.Millisecond {
+						time.Sleep(time.Millisecond)
+					}
+					resp, err := c.Begin(s.key, []byte(s.body))
+					if !errors.Is(err, s.wantErr) {
+						t.Fatalf("step %d: Begin error = %v, want %v", i, err, s.wantErr)
+					}
+					if (resp != nil) != s.wantResp {
+						t.Fatalf("step %d: Begin response = %v, want one: %v", i, resp, s.wantResp)
+					}
+					if resp != nil && (resp.StatusCode != 201 || string(resp.Body) != "created") {
+						t.Errorf("step %d: replayed %d %q, want 201 %q", i, resp.StatusCode, resp.Body, "created")
+					}
+				}
+			}
+		})
+	}
+}
@@ -3,30 +3,85 @@ package manager
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"net/http"
 	url2 "net/url"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/golang-collections/collections/queue"
 	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/node"
+	"github.com/reversearrow/orchestrator/scheduler"
 	"github.com/reversearrow/orchestrator/task"
 	"github.com/reversearrow/orchestrator/worker"
 )
 
 type Manager struct {
-	Pending       queue.Queue
+	Pending       FairQueue
 	TaskDb        map[uuid.UUID]*task.Task
 	EventDb       map[uuid.UUID]*task.TaskEvent
 	Workers       []string
+	WorkerNodes   []*node.Node
 	WorkerTaskMap map[string][]uuid.UUID
 	TaskWorkerMap map[uuid.UUID]string
-	LastWorker    int
+	Scheme        string
+	Scheduler     scheduler.Scheduler
+	Preemption    bool
+	Admission     []AdmissionController
+	Quotas        map[string]Quota
+	History       *History
+	Watcher       *Watcher
 	Logger        *log.Logger
 	client        *http.Client
+
+	workerFailures  map[string]int
+	rejectedReports uint64
+	// preempted holds why the scheduler is stopping a task: to make room for
+	// a task of higher priority or because of a NoExecute taint.
+	preempted map[uuid.UUID]string
+	// retired holds the container of the finished run of a rescheduled task,
+	// so that late reports about that run are not applied to the new one.
+	retired map[uuid.UUID]string
+	// patching holds the patch that undoes an update of a running task until
+	// its worker has applied the update.
+	patching map[uuid.UUID]TaskPatch
+
+	// mu guards the task, event and node state above. Unexported helpers
+	// expect it to be held; it is never held across requests to workers.
+	mu sync.Mutex
 }
 
+// lostWorkerThreshold is the number of consecutive failed heartbeats after
+// which the tasks of a worker are considered lost.
+const lostWorkerThreshold = 3
+
+const (
+	nodeHeartbeatInterval = 10 * time.Second
+	taskResyncInterval    = time.Minute
+	unschedulableBackoff  = 10 * time.Second
+)
+
+var (
+	ErrTaskNotFound      = errors.New("task not found")
+	ErrNodeNotFound      = errors.New("node not found")
+	ErrInvalidTransition = errors.New("invalid state transition")
+	ErrInvalidQuery      = errors.New("invalid query")
+	ErrInvalidTask       = errors.New("invalid task")
+	ErrNameConflict      = errors.New("task name already in use")
+	ErrTaskExists        = errors.New("task already exists")
+)
+
+const (
+	defaultHistoryPerTask = 1000
+	defaultHistoryMaxAge  = 7 * 24 * time.Hour
+	defaultWatchBacklog   = 10000
+)
+
 func NewManager(l *log.Logger, c *http.Client, workers []string) (*Manager, error) {
 	m := &Manager{
 		TaskDb:        make(map[uuid.UUID]*task.Task),
@@ -34,13 +89,24 @@ func NewManager(l *log.Logger, c *http.Client, workers []string) (*Manager, erro
 		Workers:       workers,
 		WorkerTaskMap: make(map[string][]uuid.UUID),
 		TaskWorkerMap: make(map[uuid.UUID]string),
-		LastWorker:    0,
+		Scheme:        "http",
+		Scheduler:     &scheduler.RoundRobin{Name: "roundrobin"},
+		Admission:     []AdmissionController{&Defaults{}},
+		Quotas:        make(map[string]Quota),
+		History:       NewHistory(defaultHistoryPerTask, defaultHistoryMaxAge),
+		Watcher:       NewWatcher(defaultWatchBacklog),
 		Logger:        l,
 		client:        c,
+
+		workerFailures: make(map[string]int),
+		preempted:      make(map[uuid.UUID]string),
+		retired:        make(map[uuid.UUID]string),
+		patching:       make(map[uuid.UUID]TaskPatch),
 	}
 
 	for w := range workers {
 		m.WorkerTaskMap[workers[w]] = []uuid.UUID{}
+		m.WorkerNodes = append(m.WorkerNodes, node.NewNode(workers[w], "worker"))
 	}
 
 	return m, m.validate()
@@ -55,6 +121,10 @@ func (m *Manager) validate() error {
 		return fmt.Errorf("http client is nil")
 	}
 
+	if m.Scheme != "http" && m.Scheme != "https" {
+		return fmt.Errorf("invalid scheme %q", m.Scheme)
+	}
+
 	if len(m.Workers) == 0 {
 		return fmt.Errorf("no worker provided cannot start the manager")
 	}
@@ -62,78 +132,527 @@ func (m *Manager) validate() error {
 	return nil
 }
 
-func (m *Manager) AddTasks(te task.TaskEvent) {
+// AddTasks enqueues te. Other than a stop, it must submit a new task, which
+// is rejected if another live task in its namespace already has its name, or
+// if it does not fit the namespace quota.
+func (m *Manager) AddTasks(te task.TaskEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if te.State != task.Stopping {
+		if _, ok := m.TaskDb[te.Task.ID]; ok {
+			return fmt.Errorf("%w: %v", ErrTaskExists, te.Task.ID)
+		}
+		if err := m.checkName(te.Task); err != nil {
+			return err
+		}
+		if err := m.checkQuota(nil, te.Task, QuotaUsage{}); err != nil {
+			return err
+		}
+	}
+	m.addTasks(te)
+	return nil
+}
+
+func (m *Manager) checkName(t task.Task) error {
+	if t.Name == "" {
+		return nil
+	}
+	for _, other := range m.TaskDb {
+		if other.ID != t.ID && other.Namespace == t.Namespace && other.Name == t.Name && !task.IsTerminal(other.State) {
+			return fmt.Errorf("%w: %q in namespace %q is used by task %v", ErrNameConflict, t.Name, t.Namespace, other.ID)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) addTasks(te task.TaskEvent) {
+	if te.State != task.Stopping {
+		if _, ok := m.TaskDb[te.Task.ID]; !ok {
+			t := te.Task
+			t.State = task.Pending
+			m.TaskDb[t.ID] = &t
+			m.recordTransition(&t, task.Pending, SourceApi, "task submitted")
+		}
+	}
 	m.Pending.Enqueue(te)
 }
 
-func (m *Manager) SelectWorker() string {
-	if m.LastWorker == len(m.Workers)-1 {
-		m.LastWorker = 0
-		return m.Workers[m.LastWorker]
+func (m *Manager) recordWorkerFailure(w string) {
+	m.workerFailures[w]++
+	if m.workerFailures[w] < lostWorkerThreshold {
+		return
+	}
+	if m.workerFailures[w] == lostWorkerThreshold {
+		m.publishNode(w, NodeUnreachable)
+	}
+
+	for _, id := range m.WorkerTaskMap[w] {
+		t, ok := m.TaskDb[id]
+		if !ok || t.State == task.Lost || !task.ValidStateTransition(t.State, task.Lost) {
+			continue
+		}
+		m.Logger.Printf("worker %v is unreachable, marking task %v as lost\n", w, id)
+		m.setState(t, task.Lost, SourceManager, "worker unreachable")
+	}
+}
+
+func (m *Manager) SelectWorker(t task.Task) (*node.Node, error) {
+	for _, n := range m.WorkerNodes {
+		n.Placements = m.placements(n.Name, nil)
+	}
+
+	candidates := m.Scheduler.SelectCandidateNodes(t, m.WorkerNodes)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no available candidates match resource request for task %v", t.ID)
+	}
+
+	scores := m.Scheduler.Score(t, candidates)
+	selected := m.Scheduler.Pick(scores, candidates)
+	if selected == nil {
+		return nil, fmt.Errorf("scheduler did not pick a node for task %v", t.ID)
+	}
+
+	return selected, nil
+}
+
+func (m *Manager) getNode(name string) *node.Node {
+	for _, n := range m.WorkerNodes {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+func (m *Manager) reserveResources(n *node.Node, t *task.Task) {
+	n.CpuAllocated += t.CpuRequested()
+	n.DiskAllocated += t.Disk
+	n.TaskCount++
+}
+
+func (m *Manager) releaseResources(t *task.Task) {
+	n := m.getNode(m.TaskWorkerMap[t.ID])
+	if n == nil {
+		return
+	}
+
+	n.CpuAllocated -= t.CpuRequested()
+	if n.CpuAllocated < 0 {
+		n.CpuAllocated = 0
+	}
+	n.DiskAllocated -= t.Disk
+	if n.DiskAllocated < 0 {
+		n.DiskAllocated = 0
+	}
+	n.TaskCount--
+}
+
+// unassign releases the resources reserved for t and removes it from its
+// worker.
+func (m *Manager) unassign(t *task.Task) {
+	m.releaseResources(t)
+	w := m.TaskWorkerMap[t.ID]
+	delete(m.TaskWorkerMap, t.ID)
+	m.WorkerTaskMap[w] = slices.DeleteFunc(m.WorkerTaskMap[w], func(id uuid.UUID) bool {
+		return id == t.ID
+	})
+}
+
+// placements lists the tasks assigned to the named node, leaving out those
+// in exclude.
+func (m *Manager) placements(name string, exclude []*task.Task) []node.Placement {
+	var ps []node.Placement
+	for _, id := range m.WorkerTaskMap[name] {
+		t, ok := m.TaskDb[id]
+		if !ok || m.TaskWorkerMap[id] != name || t.State == task.Pending || task.IsTerminal(t.State) {
+			continue
+		}
+		if slices.Contains(exclude, t) {
+			continue
+		}
+		ps = append(ps, node.Placement{Namespace: t.Namespace, Labels: t.Labels})
+	}
+	return ps
+}
+
+// RegisterNode adds a worker to the cluster. Registering a known worker again
+// is not an error; it reports whether the worker is new. The labels and
+// taints a worker registers with are merged into those it already has.
+func (m *Manager) RegisterNode(name string, labels map[string]string, taints []node.Taint) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n := m.getNode(name); n != nil {
+		if len(labels) > 0 {
+			merged := maps.Clone(n.Labels)
+			if merged == nil {
+				merged = make(map[string]string)
+			}
+			maps.Copy(merged, labels)
+			n.Labels = merged
+		}
+		merged := slices.Clone(n.Taints)
+		for _, t := range taints {
+			if !slices.Contains(merged, t) {
+				merged = append(merged, t)
+			}
+		}
+		if len(labels) > 0 || len(merged) > len(n.Taints) {
+			n.Taints = merged
+			m.evictUntolerated(n)
+			m.publishNode(name, NodeUpdated)
+		}
+		return false
+	}
+
+	n := node.NewNode(name, "worker")
+	n.Labels = maps.Clone(labels)
+	n.Taints = slices.Clone(taints)
+	m.Workers = append(m.Workers, name)
+	m.WorkerTaskMap[name] = []uuid.UUID{}
+	m.WorkerNodes = append(m.WorkerNodes, n)
+	m.publishNode(name, NodeReady)
+	return true
+}
+
+// SetNodeLabels replaces the labels of a node. Tasks already on the node are
+// not affected.
+func (m *Manager) SetNodeLabels(name string, labels map[string]string) (node.Node, error) {
+	if err := node.ValidateLabels(labels); err != nil {
+		return node.Node{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.getNode(name)
+	if n == nil {
+		return node.Node{}, fmt.Errorf("%w: %q", ErrNodeNotFound, name)
+	}
+
+	n.Labels = maps.Clone(labels)
+	m.publishNode(name, NodeUpdated)
+	return *n, nil
+}
+
+// SetNodeTaints replaces the taints of a node. Tasks on the node that do not
+// tolerate a NoExecute taint are evicted: they are stopped and then
+// rescheduled or failed according to their preemption policy.
+func (m *Manager) SetNodeTaints(name string, taints []node.Taint) (node.Node, error) {
+	if err := node.ValidateTaints(taints); err != nil {
+		return node.Node{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.getNode(name)
+	if n == nil {
+		return node.Node{}, fmt.Errorf("%w: %q", ErrNodeNotFound, name)
+	}
+
+	n.Taints = slices.Clone(taints)
+	m.evictUntolerated(n)
+	m.publishNode(name, NodeUpdated)
+	return *n, nil
+}
+
+// RejectedReports counts the task reports from workers that were ignored
+// because the worker did not own the task or the change was not allowed.
+func (m *Manager) RejectedReports() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.rejectedReports
+}
+
+func (m *Manager) QueueStats() []TenantQueueStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.Pending.Stats()
+}
+
+func (m *Manager) workerNames() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.Workers...)
+}
+
+// updateNodeStats refreshes node capacity and doubles as the heartbeat used to
+// detect unreachable workers.
+func (m *Manager) updateNodeStats() {
+	for _, w := range m.workerNames() {
+		resp, err := m.client.Get(fmt.Sprintf("%s://%v/stats", m.Scheme, w))
+		if err != nil {
+			m.Logger.Printf("error fetching stats from node %v: %v\n", w, err)
+			m.mu.Lock()
+			m.recordWorkerFailure(w)
+			m.mu.Unlock()
+			continue
+		}
+
+		var s worker.Stats
+		err = json.NewDecoder(resp.Body).Decode(&s)
+		resp.Body.Close()
+		if err != nil {
+			m.Logger.Printf("error decoding stats from node %v: %v\n", w, err)
+			continue
+		}
+
+		images := m.fetchNodeImages(w)
+
+		m.mu.Lock()
+		m.recordWorkerSuccess(w)
+		if n := m.getNode(w); n != nil {
+			if s.CpuCount > 0 {
+				n.Cores = s.CpuCount
+			}
+			if s.MemStats != nil {
+				n.Memory = int(s.MemTotalKb() * 1024)
+			}
+			if s.DiskStats != nil {
+				n.Disk = int(s.DiskTotal())
+			}
+			if images != nil {
+				n.Images = images
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+func (m *Manager) recordWorkerSuccess(w string) {
+	if m.workerFailures[w] >= lostWorkerThreshold {
+		m.publishNode(w, NodeReady)
+	}
+	m.workerFailures[w] = 0
+}
+
+func (m *Manager) fetchNodeImages(name string) []string {
+	resp, err := m.client.Get(fmt.Sprintf("%s://%v/images", m.Scheme, name))
+	if err != nil {
+		m.Logger.Printf("error fetching images from node %v: %v\n", name, err)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		m.Logger.Printf("error fetching images from node %v, resp code: %v\n", name, resp.StatusCode)
+		return nil
+	}
+
+	images := []string{}
+	if err := json.NewDecoder(resp.Body).Decode(&images); err != nil {
+		m.Logger.Printf("error decoding images from node %v: %v\n", name, err)
+		return nil
+	}
+	return images
+}
+
+func (m *Manager) PrePullImages(images []string, nodes []string) error {
+	m.mu.Lock()
+	targets := make([]string, 0, len(m.WorkerNodes))
+	if len(nodes) == 0 {
+		for _, n := range m.WorkerNodes {
+			targets = append(targets, n.Name)
+		}
+	}
+	for _, name := range nodes {
+		if m.getNode(name) == nil {
+			m.mu.Unlock()
+			return fmt.Errorf("%w: %q", ErrNodeNotFound, name)
+		}
+		targets = append(targets, name)
+	}
+	m.mu.Unlock()
+
+	data, err := json.Marshal(worker.PrePullRequest{Images: images})
+	if err != nil {
+		return fmt.Errorf("error marshalling pre-pull request: %w", err)
 	}
 
-	m.LastWorker++
-	return m.Workers[m.LastWorker]
+	for _, n := range targets {
+		u := url2.URL{
+			Scheme: m.Scheme,
+			Host:   n,
+			Path:   "images",
+		}
+		resp, err := m.client.Post(u.String(), "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			m.Logger.Printf("error connecting to url: %q, err: %v\n", u.String(), err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			m.Logger.Printf("error requesting pre-pull on node %v, resp code: %v\n", n, resp.StatusCode)
+			continue
+		}
+		m.Logger.Printf("requested pre-pull of %v on node %v\n", images, n)
+	}
+
+	return nil
+}
+
+func (m *Manager) GetNodes() []node.Node {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nodes := make([]node.Node, 0, len(m.WorkerNodes))
+	for _, n := range m.WorkerNodes {
+		nodes = append(nodes, *n)
+	}
+	return nodes
 }
 
+// updateTasks is the periodic full resync with every worker. Workers push
+// state changes as they happen, this catches anything those pushes missed.
 func (m *Manager) updateTasks() {
-	for _, w := range m.Workers {
+	for _, w := range m.workerNames() {
 		m.Logger.Printf("checking worker: %v for the task updates", w)
 
-		resp, err := m.client.Get(fmt.Sprintf("http://%v/tasks", w))
+		resp, err := m.client.Get(fmt.Sprintf("%s://%v/tasks", m.Scheme, w))
 		if err != nil {
 			m.Logger.Printf("error making a request: %v\n", err)
+			continue
 		}
 		if resp.StatusCode != http.StatusOK {
 			m.Logger.Printf("error fetching tasks, resp code: %v\n", resp.StatusCode)
+			resp.Body.Close()
 			continue
 		}
-		var te []*task.Task
-		if err := json.NewDecoder(resp.Body).Decode(&te); err != nil {
+		te, err := task.DecodeTasks(resp.Body)
+		resp.Body.Close()
+		if err != nil {
 			log.Printf("error decoding tasks: %v\n", err)
 			continue
 		}
 
-		for _, t := range te {
-			taskFromDB, ok := m.TaskDb[t.ID]
-			if !ok {
-				m.Logger.Fatal("task not found in the db: %v", t.ID)
+		m.mu.Lock()
+		m.applyTaskUpdates(w, te, "resynced from worker")
+		m.mu.Unlock()
+	}
+}
+
+// ReportTasks applies task state changes pushed by a worker.
+func (m *Manager) ReportTasks(w string, tasks []*task.Task) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.getNode(w) == nil {
+		return fmt.Errorf("%w: %q", ErrNodeNotFound, w)
+	}
+
+	m.recordWorkerSuccess(w)
+	m.applyTaskUpdates(w, tasks, "reported by worker")
+	return nil
+}
+
+func (m *Manager) applyTaskUpdates(w string, tasks []*task.Task, reason string) {
+	for _, t := range tasks {
+		taskFromDB, ok := m.TaskDb[t.ID]
+		if !ok {
+			m.Logger.Printf("worker %v reported unknown task %v\n", w, t.ID)
+			continue
+		}
+		if m.TaskWorkerMap[t.ID] != w {
+			m.rejectedReports++
+			m.Logger.Printf("ignoring report of task %v from worker %v, which does not own it\n", t.ID, w)
+			continue
+		}
+
+		if c, ok := m.retired[t.ID]; ok {
+			if t.ContainerID == c {
+				continue
 			}
+			delete(m.retired, t.ID)
+		}
 
-			if taskFromDB.State != t.State {
-				taskFromDB.State = t.State
+		if _, ok := m.preempted[t.ID]; ok && task.IsTerminal(t.State) {
+			m.finishPreemption(taskFromDB)
+			continue
+		}
+
+		if taskFromDB.State != t.State && !task.ValidStateTransition(taskFromDB.State, t.State) {
+			// Reports can skip Running when a task exits between two of them.
+			if taskFromDB.State != task.Scheduled || !task.ValidStateTransition(task.Running, t.State) {
+				m.rejectedReports++
+				m.Logger.Printf("ignoring report of task %v from worker %v: invalid transition from %v to %v\n", t.ID, w, taskFromDB.State, t.State)
+				continue
 			}
+			m.setState(taskFromDB, task.Running, SourceWorker, reason)
+		}
 
-			taskFromDB.StartTime = t.StartTime
-			taskFromDB.FinishTime = t.FinishTime
-			taskFromDB.ContainerID = t.ContainerID
-			m.TaskDb[taskFromDB.ID] = taskFromDB
+		taskFromDB.Error = t.Error
+		if taskFromDB.State != t.State {
+			if task.IsTerminal(t.State) && !task.IsTerminal(taskFromDB.State) {
+				m.releaseResources(taskFromDB)
+			}
+			m.setState(taskFromDB, t.State, SourceWorker, reason)
 		}
+
+		taskFromDB.StartTime = t.StartTime
+		taskFromDB.FinishTime = t.FinishTime
+		taskFromDB.ContainerID = t.ContainerID
+		taskFromDB.PullProgress = t.PullProgress
 	}
 }
 
 func (m *Manager) SendWork() {
-	if m.Pending.Len() == 0 {
+	m.mu.Lock()
+	taskEvent, ok := m.Pending.Dequeue()
+	if !ok {
+		m.mu.Unlock()
 		m.Logger.Println("no pending tasks to run in the manager")
 		return
 	}
+	t := taskEvent.Task
+	log.Printf("pulled %v off pending queue\n", t)
 
-	e := m.Pending.Dequeue()
-	taskEvent, ok := e.(task.TaskEvent)
-	if !ok {
-		m.Logger.Printf("invalid type found, expected task event")
+	switch taskEvent.State {
+	case task.Stopping:
+		m.mu.Unlock()
+		m.stopTask(taskEvent)
+		return
+	case task.Running, task.Restarting:
+		m.mu.Unlock()
+		m.updateTask(taskEvent)
 		return
 	}
-	t := taskEvent.Task
-	log.Printf("pulled %v off pending queue\n", t)
+
+	if persisted, ok := m.TaskDb[t.ID]; ok {
+		if persisted.State != task.Pending {
+			m.mu.Unlock()
+			m.Logger.Printf("task %v is %v, not scheduling it\n", t.ID, persisted.State)
+			return
+		}
+		t = *persisted
+	}
+
+	n, err := m.SelectWorker(t)
+	if err != nil {
+		if m.Preemption && m.preempt(t) {
+			m.Logger.Printf("preempting lower priority tasks to make room for task %v\n", t.ID)
+		}
+		m.Pending.EnqueueAfter(taskEvent, unschedulableBackoff)
+		m.mu.Unlock()
+		m.Logger.Printf("unable to schedule task %v: %v\n", t.ID, err)
+		return
+	}
+	w := n.Name
 
 	m.EventDb[taskEvent.ID] = &taskEvent
-	w := m.SelectWorker()
 	m.WorkerTaskMap[w] = append(m.WorkerTaskMap[w], t.ID)
 	m.TaskWorkerMap[t.ID] = w
 
-	t.State = task.Scheduled
+	m.setState(&t, task.Scheduled, SourceScheduler, fmt.Sprintf("scheduled on %s", w))
 	m.TaskDb[t.ID] = &t
+	m.reserveResources(n, &t)
+	taskEvent.State = task.Scheduled
+	taskEvent.Task = t
+	m.mu.Unlock()
 
 	data, err := json.Marshal(taskEvent)
 	if err != nil {
@@ -142,54 +661,258 @@ func (m *Manager) SendWork() {
 	}
 
 	u := url2.URL{
-		Scheme: "http",
+		Scheme: m.Scheme,
 		Host:   w,
 		Path:   "tasks",
 	}
 	resp, err := m.client.Post(u.String(), "application/json", bytes.NewBuffer(data))
 	if err != nil {
 		m.Logger.Printf("error connecting to url: %q, err: %v\n.", u.String(), err)
-		m.AddTasks(taskEvent)
+		m.rejectedByWorker(t.ID, 0, fmt.Sprintf("worker %s unreachable", w))
 		return
 	}
+	defer resp.Body.Close()
 
 	d := json.NewDecoder(resp.Body)
 	if resp.StatusCode != http.StatusCreated {
+		msg := fmt.Sprintf("worker %s rejected the task with status %d", w, resp.StatusCode)
 		e := worker.ErrorResponse{}
-		err := d.Decode(&e)
-		if err != nil {
-			m.Logger.Printf("error decoding: %v", err)
-			return
+		if err := d.Decode(&e); err == nil && e.Message != "" {
+			msg = fmt.Sprintf("worker %s rejected the task: %s", w, strings.TrimSpace(e.Message))
 		}
-		m.Logger.Printf("response error (%d): %s", e.HTTPStatusCode, e.Message)
+		m.Logger.Printf("task %v: %s\n", t.ID, msg)
+		m.rejectedByWorker(t.ID, resp.StatusCode, msg)
 		return
 	}
 
-	t = task.Task{}
-	err = d.Decode(&t)
+	accepted, err := task.DecodeTask(resp.Body)
 	if err != nil {
 		m.Logger.Printf("error decoding response: %s\n", err.Error())
 		return
 	}
-	m.Logger.Printf("%#v\n", t)
+	m.Logger.Printf("%#v\n", accepted)
+}
+
+// rejectedByWorker undoes the placement of a task its worker refused, or
+// could not be reached for, in which case status is 0. A task the worker
+// could not accept is failed; other refusals are retried after a backoff.
+func (m *Manager) rejectedByWorker(id uuid.UUID, status int, msg string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.TaskDb[id]
+	if !ok || t.State != task.Scheduled {
+		return
+	}
+	m.unassign(t)
+
+	if status == http.StatusBadRequest {
+		t.Error = msg
+		t.FinishTime = time.Now().UTC()
+		m.setState(t, task.Failed, SourceManager, msg)
+		return
+	}
+
+	m.setState(t, task.Pending, SourceManager, msg+", requeued")
+	m.Pending.EnqueueAfter(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Pending,
+		Timestamp: time.Now().UTC(),
+		Task:      *t,
+	}, unschedulableBackoff)
+}
+
+func (m *Manager) stopTask(te task.TaskEvent) {
+	m.mu.Lock()
+	w, ok := m.TaskWorkerMap[te.Task.ID]
+	m.mu.Unlock()
+	if !ok {
+		m.Logger.Printf("no worker found for task %v\n", te.Task.ID)
+		return
+	}
+
+	u := url2.URL{
+		Scheme: m.Scheme,
+		Host:   w,
+		Path:   fmt.Sprintf("tasks/%s", te.Task.ID),
+	}
+	req, err := http.NewRequest(http.MethodDelete, u.String(), nil)
+	if err != nil {
+		m.Logger.Printf("error creating request to stop task %v: %v\n", te.Task.ID, err)
+		return
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		m.Logger.Printf("error connecting to url: %q, err: %v\n", u.String(), err)
+		m.retryStop(te)
+		return
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+	case http.StatusNotFound:
+		m.Logger.Printf("worker %v does not have task %v, no container to stop\n", w, te.Task.ID)
+		m.stoppedWithoutWorker(te.Task.ID, w)
+		return
+	default:
+		m.Logger.Printf("error stopping task %v, resp code: %v, retrying\n", te.Task.ID, resp.StatusCode)
+		m.retryStop(te)
+		return
+	}
+
+	m.mu.Lock()
+	m.EventDb[te.ID] = &te
+	if t, ok := m.TaskDb[te.Task.ID]; ok && task.ValidStateTransition(t.State, task.Stopping) {
+		if reason, ok := m.preempted[t.ID]; ok {
+			m.setState(t, task.Stopping, SourceScheduler, reason)
+		} else {
+			m.setState(t, task.Stopping, SourceApi, "stop requested")
+		}
+	}
+	m.mu.Unlock()
+	m.Logger.Printf("requested worker %v to stop task %v\n", w, te.Task.ID)
+}
+
+// retryStop puts a stop the worker did not act on back in the queue, unless
+// the task has finished in the meantime.
+func (m *Manager) retryStop(te task.TaskEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t, ok := m.TaskDb[te.Task.ID]; ok && task.IsTerminal(t.State) {
+		return
+	}
+	m.Pending.EnqueueAfter(te, unschedulableBackoff)
+}
+
+// stoppedWithoutWorker finishes the stop of a task its worker no longer
+// knows about, for example after the worker restarted. There is no container
+// left to stop: a preempted or evicted task carries on as if its worker had
+// stopped it, and any other task is completed.
+func (m *Manager) stoppedWithoutWorker(id uuid.UUID, w string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.TaskDb[id]
+	if !ok || m.TaskWorkerMap[id] != w || task.IsTerminal(t.State) {
+		return
+	}
+	if _, ok := m.preempted[id]; ok {
+		m.finishPreemption(t)
+		return
+	}
+
+	m.unassign(t)
+	t.FinishTime = time.Now().UTC()
+	m.setState(t, task.Completed, SourceApi, fmt.Sprintf("stop requested, task not found on %s", w))
 }
 
-func (m *Manager) GetAllTasks() []*task.Task {
-	tasks := make([]*task.Task, 0, len(m.TaskDb))
-	for _, t := range m.TaskDb {
-		tasks = append(tasks, t)
+func (m *Manager) setState(t *task.Task, to task.State, source string, reason string) {
+	if t.State == to {
+		return
 	}
+	m.recordTransition(t, to, source, reason)
+	t.State = to
+}
 
-	return tasks
+func (m *Manager) recordTransition(t *task.Task, to task.State, source string, reason string) {
+	e := HistoryEntry{
+		TaskID:    t.ID,
+		From:      t.State,
+		To:        to,
+		Source:    source,
+		Reason:    reason,
+		Worker:    m.TaskWorkerMap[t.ID],
+		Error:     t.Error,
+		Timestamp: time.Now().UTC(),
+	}
+	m.History.Append(e)
+
+	tc := *t
+	tc.State = to
+	m.Watcher.Publish(WatchEvent{
+		Kind:       WatchKindTask,
+		Task:       &tc,
+		Transition: &e,
+		Timestamp:  e.Timestamp,
+	})
+}
+
+func (m *Manager) publishNode(name string, status string) {
+	n := m.getNode(name)
+	if n == nil {
+		return
+	}
+
+	nc := *n
+	m.Watcher.Publish(WatchEvent{
+		Kind:       WatchKindNode,
+		Node:       &nc,
+		NodeStatus: status,
+	})
+}
+
+func (m *Manager) GetTaskHistory(id uuid.UUID) ([]HistoryEntry, bool) {
+	m.mu.Lock()
+	_, ok := m.TaskDb[id]
+	m.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return m.History.Get(id), true
+}
+
+// StopTask cancels a task that has not been scheduled yet, or queues a
+// request for its worker to stop it.
+func (m *Manager) StopTask(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.stopTaskLocked(id)
+}
+
+func (m *Manager) stopTaskLocked(id uuid.UUID) error {
+	t, ok := m.TaskDb[id]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrTaskNotFound, id)
+	}
+
+	if t.State == task.Pending {
+		m.setState(t, task.Cancelled, SourceApi, "cancelled before scheduling")
+		return nil
+	}
+	if !task.ValidStateTransition(t.State, task.Stopping) {
+		return fmt.Errorf("%w: task %v is %v and cannot be stopped", ErrInvalidTransition, id, t.State)
+	}
+
+	taskCopy := *t
+	taskCopy.State = task.Stopping
+	m.addTasks(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Stopping,
+		Timestamp: time.Now().UTC(),
+		Task:      taskCopy,
+	})
+	return nil
+}
+
+func (m *Manager) UpdateNodes() {
+	for {
+		m.Logger.Println("checking for node stats from workers")
+		m.updateNodeStats()
+		time.Sleep(nodeHeartbeatInterval)
+	}
 }
 
 func (m *Manager) UpdateTasks() {
 	for {
-		m.Logger.Println("checking for task updates from workers")
+		m.Logger.Println("resyncing task state from workers")
 		m.updateTasks()
-		m.Logger.Printf("task updates completed")
-		m.Logger.Printf("sleeping for 10 seconds")
-		time.Sleep(10 * time.Second)
+		m.Logger.Printf("task resync completed")
+		m.Logger.Printf("sleeping for %v", taskResyncInterval)
+		time.Sleep(taskResyncInterval)
 	}
 }
 
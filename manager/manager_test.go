@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+func TestStopTaskResponses(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		preempted bool
+		policy    string
+		want      task.State
+		queued    int
+		assigned  bool
+		allocated float64
+	}{
+		{name: "stopped", status: http.StatusNoContent, want: task.Stopping, assigned: true, allocated: 1},
+		{name: "worker error is retried", status: http.StatusInternalServerError, want: task.Running, queued: 1, assigned: true, allocated: 1},
+		{name: "unknown to the worker", status: http.StatusNotFound, want: task.Completed},
+		{name: "preempted and unknown to the worker", status: http.StatusNotFound, preempted: true, want: task.Pending, queued: 1},
+		{
+			name: "preempted with fail policy and unknown to the worker", status: http.StatusNotFound,
+			preempted: true, policy: task.PreemptFail, want: task.Failed, assigned: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+			u, _ := url.Parse(srv.URL)
+			w := u.Host
+
+			m, err := NewManager(log.New(io.Discard, "", 0), srv.Client(), []string{w})
+			if err != nil {
+				t.Fatalf("NewManager: %v", err)
+			}
+			v := &task.Task{ID: uuid.New(), State: task.Running, CpuRequest: 1, PreemptionPolicy: tt.policy}
+			m.TaskDb[v.ID] = v
+			m.TaskWorkerMap[v.ID] = w
+			m.WorkerTaskMap[w] = []uuid.UUID{v.ID}
+			m.reserveResources(m.getNode(w), v)
+			if tt.preempted {
+				m.preempted[v.ID] = "preempted by a test"
+			}
+
+			tc := *v
+			tc.State = task.Stopping
+			m.stopTask(task.TaskEvent{ID: uuid.New(), State: task.Stopping, Task: tc})
+
+			if v.State != tt.want {
+				t.Errorf("state = %v, want %v", v.State, tt.want)
+			}
+			if got := m.Pending.Len(); got != tt.queued {
+				t.Errorf("%d events queued, want %d", got, tt.queued)
+			}
+			if _, ok := m.TaskWorkerMap[v.ID]; ok != tt.assigned {
+				t.Errorf("assigned = %v, want %v", ok, tt.assigned)
+			}
+			if _, ok := m.preempted[v.ID]; ok && tt.status == http.StatusNotFound {
+				t.Errorf("task is still marked as preempted")
+			}
+			if got := m.getNode(w).CpuAllocated; got != tt.allocated {
+				t.Errorf("node has %v cpu allocated, want %v", got, tt.allocated)
+			}
+		})
+	}
+}
+
+func TestSendWorkRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int // 0 for an unreachable worker
+		want   task.State
+		queued int
+	}{
+		{name: "unreachable worker", want: task.Pending, queued: 1},
+		{name: "worker unavailable", status: http.StatusServiceUnavailable, want: task.Pending, queued: 1},
+		{name: "invalid task", status: http.StatusBadRequest, want: task.Failed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+			u, _ := url.Parse(srv.URL)
+			w := u.Host
+			if tt.status == 0 {
+				srv.Close()
+			}
+
+			m, err := NewManager(log.New(io.Discard, "", 0), srv.Client(), []string{w})
+			if err != nil {
+				t.Fatalf("NewManager: %v", err)
+			}
+			m.getNode(w).Cores = 2
+			if err := m.AddTasks(task.TaskEvent{
+				ID:    uuid.New(),
+				State: task.Pending,
+				Task:  task.Task{ID: uuid.New(), Namespace: task.DefaultNamespace, State: task.Pending, CpuRequest: 1},
+			}); err != nil {
+				t.Fatalf("AddTasks: %v", err)
+			}
+
+			m.SendWork()
+
+			var v *task.Task
+			for _, tk := range m.TaskDb {
+				v = tk
+			}
+			if v.State != tt.want {
+				t.Errorf("state = %v, want %v", v.State, tt.want)
+			}
+			if _, ok := m.TaskWorkerMap[v.ID]; ok || len(m.WorkerTaskMap[w]) != 0 {
+				t.Errorf("task is still assigned to %s", w)
+			}
+			if got := m.getNode(w).CpuAllocated; got != 0 {
+				t.Errorf("node has %v cpu allocated, want 0", got)
+			}
+			if got := m.Pending.Len(); got != tt.queued {
+				t.Fatalf("%d events queued, want %d", got, tt.queued)
+			}
+			if _, ok := m.Pending.Dequeue(); ok {
+				t.Errorf("retry was queued without a backoff")
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	url2 "net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/task"
+	"github.com/reversearrow/orchestrator/worker"
+)
+
+const (
+	PatchPending = "Pending"
+	PatchInPlace = "InPlace"
+	PatchReplace = "Replace"
+)
+
+var ErrInsufficientResources = errors.New("insufficient resources")
+
+// TaskPatch lists the fields of a task that can change after submission.
+// Unset fields are left as they are.
+type TaskPatch struct {
+	Image         *string   `json:"image,omitempty"`
+	Env           *[]string `json:"env,omitempty"`
+	CpuRequest    *float64  `json:"cpuRequest,omitempty"`
+	CpuLimit      *float64  `json:"cpuLimit,omitempty"`
+	Memory        *int      `json:"memory,omitempty"`
+	Disk          *int      `json:"disk,omitempty"`
+	RestartPolicy *string   `json:"restartPolicy,omitempty"`
+}
+
+type PatchResult struct {
+	Mode string     `json:"mode"`
+	Task *task.Task `json:"task"`
+}
+
+func DecodeTaskPatch(r io.Reader) (TaskPatch, error) {
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+
+	var p TaskPatch
+	if err := d.Decode(&p); err != nil {
+		return TaskPatch{}, err
+	}
+	return p, nil
+}
+
+func (p TaskPatch) apply(t task.Task) (task.Task, error) {
+	if p.Image != nil {
+		t.Image = *p.Image
+	}
+	if p.Env != nil {
+		t.Env = *p.Env
+	}
+	if p.CpuRequest != nil {
+		t.CpuRequest = *p.CpuRequest
+	}
+	if p.CpuLimit != nil {
+		t.CpuLimit = *p.CpuLimit
+	}
+	if p.Memory != nil {
+		t.Memory = *p.Memory
+	}
+	if p.Disk != nil {
+		t.Disk = *p.Disk
+	}
+	if p.RestartPolicy != nil {
+		t.RestartPolicy = *p.RestartPolicy
+	}
+
+	if errs := validateTaskSpec(t, ""); len(errs) > 0 {
+		return t, &ValidationError{Errors: errs}
+	}
+	return t, nil
+}
+
+// patchFrom returns the patch that sets every patchable field to its value
+// in t.
+func patchFrom(t task.Task) TaskPatch {
+	env := slices.Clone(t.Env)
+	return TaskPatch{
+		Image:         &t.Image,
+		Env:           &env,
+		CpuRequest:    &t.CpuRequest,
+		CpuLimit:      &t.CpuLimit,
+		Memory:        &t.Memory,
+		Disk:          &t.Disk,
+		RestartPolicy: &t.RestartPolicy,
+	}
+}
+
+// updatableInPlace reports whether the runtime can apply the change from old
+// to updated to the running container: only cpu, memory and restart policy.
+func updatableInPlace(old task.Task, updated task.Task) bool {
+	return old.Image == updated.Image &&
+		slices.Equal(old.Env, updated.Env) &&
+		old.Disk == updated.Disk
+}
+
+// PatchTask changes a submitted task. Pending tasks are updated before they
+// are scheduled. Running tasks keep their node: resource and restart policy
+// changes are applied in place, anything else replaces the container while
+// keeping the task's ID and history.
+func (m *Manager) PatchTask(id uuid.UUID, p TaskPatch) (PatchResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.TaskDb[id]
+	if !ok {
+		return PatchResult{}, fmt.Errorf("%w: %v", ErrTaskNotFound, id)
+	}
+
+	updated, err := p.apply(*t)
+	if err != nil {
+		return PatchResult{}, err
+	}
+
+	if !task.IsTerminal(t.State) {
+		if err := m.checkQuota(t, updated, QuotaUsage{}); err != nil {
+			return PatchResult{}, err
+		}
+	}
+
+	if t.State == task.Pending {
+		*t = updated
+		m.recordTransition(t, task.Pending, SourceApi, "spec updated")
+		tc := *t
+		return PatchResult{Mode: PatchPending, Task: &tc}, nil
+	}
+	if t.State != task.Running {
+		return PatchResult{}, fmt.Errorf("%w: task %v is %v and cannot be updated", ErrInvalidTransition, id, t.State)
+	}
+	if _, ok := m.patching[id]; ok {
+		return PatchResult{}, fmt.Errorf("%w: task %v has an update in progress", ErrInvalidTransition, id)
+	}
+
+	if n := m.getNode(m.TaskWorkerMap[id]); n != nil {
+		cpu := updated.CpuRequested() - t.CpuRequested()
+		disk := updated.Disk - t.Disk
+		if cpu > n.CpuAvailable() || disk > n.DiskAvailable() {
+			return PatchResult{}, fmt.Errorf("%w: node %v cannot fit the updated task", ErrInsufficientResources, n.Name)
+		}
+		n.CpuAllocated += cpu
+		n.DiskAllocated += disk
+	}
+
+	mode, state, reason := PatchInPlace, task.Running, "updated in place"
+	if !updatableInPlace(*t, updated) {
+		mode, state, reason = PatchReplace, task.Restarting, "replaced to apply update"
+	}
+
+	m.patching[id] = patchFrom(*t)
+	m.recordTransition(t, state, SourceApi, reason)
+	*t = updated
+	t.State = state
+
+	tc := *t
+	m.addTasks(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     state,
+		Timestamp: time.Now().UTC(),
+		Task:      tc,
+	})
+	return PatchResult{Mode: mode, Task: &tc}, nil
+}
+
+func (m *Manager) updateTask(te task.TaskEvent) {
+	m.mu.Lock()
+	w, ok := m.TaskWorkerMap[te.Task.ID]
+	m.mu.Unlock()
+	if !ok {
+		m.Logger.Printf("no worker found for task %v\n", te.Task.ID)
+		m.rollbackPatch(te.Task.ID, "task is no longer on a worker")
+		return
+	}
+
+	data, err := json.Marshal(te)
+	if err != nil {
+		m.Logger.Printf("unable to marshal task event: %v\n", err)
+		m.rollbackPatch(te.Task.ID, err.Error())
+		return
+	}
+
+	u := url2.URL{
+		Scheme: m.Scheme,
+		Host:   w,
+		Path:   fmt.Sprintf("tasks/%s", te.Task.ID),
+	}
+	req, err := http.NewRequest(http.MethodPatch, u.String(), bytes.NewBuffer(data))
+	if err != nil {
+		m.Logger.Printf("error creating request to update task %v: %v\n", te.Task.ID, err)
+		m.rollbackPatch(te.Task.ID, err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		m.Logger.Printf("error connecting to url: %q, err: %v\n", u.String(), err)
+		m.rollbackPatch(te.Task.ID, fmt.Sprintf("worker %s unreachable", w))
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		msg := fmt.Sprintf("worker %s refused the update with status %d", w, resp.StatusCode)
+		e := worker.ErrorResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(&e); err == nil && e.Message != "" {
+			msg = fmt.Sprintf("worker %s refused the update: %s", w, strings.TrimSpace(e.Message))
+		}
+		m.Logger.Printf("task %v: %s\n", te.Task.ID, msg)
+		m.rollbackPatch(te.Task.ID, msg)
+		return
+	}
+
+	m.mu.Lock()
+	delete(m.patching, te.Task.ID)
+	m.EventDb[te.ID] = &te
+	m.mu.Unlock()
+	m.Logger.Printf("requested worker %v to update task %v (%v)\n", w, te.Task.ID, te.State)
+}
+
+// rollbackPatch restores the spec and node allocation a running task had
+// before an update its worker did not apply.
+func (m *Manager) rollbackPatch(id uuid.UUID, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	undo, ok := m.patching[id]
+	if !ok {
+		return
+	}
+	delete(m.patching, id)
+
+	t, ok := m.TaskDb[id]
+	if !ok || (t.State != task.Running && t.State != task.Restarting) {
+		return
+	}
+	prev, _ := undo.apply(*t)
+	if n := m.getNode(m.TaskWorkerMap[id]); n != nil {
+		n.CpuAllocated += prev.CpuRequested() - t.CpuRequested()
+		n.DiskAllocated += prev.Disk - t.Disk
+	}
+
+	m.recordTransition(t, task.Running, SourceManager, fmt.Sprintf("update rolled back: %s", reason))
+	*t = prev
+	t.State = task.Running
+}
@@ -0,0 +1,244 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// newPatchTestManager returns a manager with one worker, served by handler,
+// running one task that requests a core.
+func newPatchTestManager(t *testing.T, handler http.HandlerFunc) (*Manager, *task.Task) {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	w := u.Host
+
+	m, err := NewManager(log.New(io.Discard, "", 0), srv.Client(), []string{w})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	m.getNode(w).Cores = 4
+	m.getNode(w).Disk = 1 << 30
+
+	r := &task.Task{
+		ID:          uuid.New(),
+		Namespace:   task.DefaultNamespace,
+		State:       task.Running,
+		Image:       "nginx:1.25",
+		CpuRequest:  1,
+		ContainerID: "c1",
+	}
+	m.TaskDb[r.ID] = r
+	m.TaskWorkerMap[r.ID] = w
+	m.WorkerTaskMap[w] = []uuid.UUID{r.ID}
+	m.reserveResources(m.getNode(w), r)
+	return m, r
+}
+
+func TestPatchTaskWorkerResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		patch     TaskPatch
+		status    int // 0 for an unreachable worker
+		wantImage string
+		wantCpu   float64
+	}{
+		{name: "in place applied", patch: TaskPatch{CpuRequest: ptr(2.0)}, status: http.StatusNoContent, wantImage: "nginx:1.25", wantCpu: 2},
+		{name: "in place refused", patch: TaskPatch{CpuRequest: ptr(2.0)}, status: http.StatusInternalServerError, wantImage: "nginx:1.25", wantCpu: 1},
+		{name: "in place unreachable", patch: TaskPatch{CpuRequest: ptr(2.0)}, wantImage: "nginx:1.25", wantCpu: 1},
+		{name: "replace applied", patch: TaskPatch{Image: ptr("nginx:1.26"), CpuRequest: ptr(3.0)}, status: http.StatusNoContent, wantImage: "nginx:1.26", wantCpu: 3},
+		{name: "replace refused", patch: TaskPatch{Image: ptr("nginx:1.26"), CpuRequest: ptr(3.0)}, status: http.StatusConflict, wantImage: "nginx:1.25", wantCpu: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, r := newPatchTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				if tt.status == 0 {
+					panic(http.ErrAbortHandler)
+				}
+				w.WriteHeader(tt.status)
+			})
+			n := m.getNode(m.TaskWorkerMap[r.ID])
+
+			result, err := m.PatchTask(r.ID, tt.patch)
+			if err != nil {
+				t.Fatalf("PatchTask: %v", err)
+			}
+			if got := n.CpuAllocated; got != *tt.patch.CpuRequest {
+				t.Errorf("allocated %v cpu before the worker answered, want %v", got, *tt.patch.CpuRequest)
+			}
+			if _, err := m.PatchTask(r.ID, TaskPatch{Memory: ptr(1)}); !errors.Is(err, ErrInvalidTransition) {
+				t.Errorf("second PatchTask error = %v, want %v", err, ErrInvalidTransition)
+			}
+
+			te, ok := m.Pending.Dequeue()
+			if !ok {
+				t.Fatalf("no update queued")
+			}
+			m.updateTask(te)
+
+			wantState := task.Running
+			if tt.status == http.StatusNoContent && result.Mode == PatchReplace {
+				wantState = task.Restarting
+			}
+			if r.State != wantState {
+				t.Errorf("state = %v, want %v", r.State, wantState)
+			}
+			if r.Image != tt.wantImage || r.CpuRequest != tt.wantCpu {
+				t.Errorf("spec = %q with %v cpu, want %q with %v cpu", r.Image, r.CpuRequest, tt.wantImage, tt.wantCpu)
+			}
+			if r.ContainerID != "c1" {
+				t.Errorf("container id = %q, want it kept", r.ContainerID)
+			}
+			if got := n.CpuAllocated; got != tt.wantCpu {
+				t.Errorf("allocated %v cpu, want %v", got, tt.wantCpu)
+			}
+			if _, ok := m.patching[r.ID]; ok {
+				t.Errorf("update is still in progress")
+			}
+		})
+	}
+}
+
+func TestPatchTask(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    task.State
+		patch    TaskPatch
+		wantMode string
+		wantErr  error
+	}{
+		{name: "pending", state: task.Pending, patch: TaskPatch{Image: ptr("nginx:1.26")}, wantMode: PatchPending},
+		{name: "cpu in place", state: task.Running, patch: TaskPatch{CpuRequest: ptr(2.0), CpuLimit: ptr(3.0)}, wantMode: PatchInPlace},
+		{name: "memory in place", state: task.Running, patch: TaskPatch{Memory: ptr(1 << 20)}, wantMode: PatchInPlace},
+		{name: "restart policy in place", state: task.Running, patch: TaskPatch{RestartPolicy: ptr("always")}, wantMode: PatchInPlace},
+		{name: "image replaces", state: task.Running, patch: TaskPatch{Image: ptr("nginx:1.26")}, wantMode: PatchReplace},
+		{name: "env replaces", state: task.Running, patch: TaskPatch{Env: &[]string{"A=1"}}, wantMode: PatchReplace},
+		{name: "disk replaces", state: task.Running, patch: TaskPatch{Disk: ptr(1 << 20)}, wantMode: PatchReplace},
+		{name: "completed", state: task.Completed, patch: TaskPatch{Memory: ptr(1)}, wantErr: ErrInvalidTransition},
+		{name: "failed", state: task.Failed, patch: TaskPatch{Memory: ptr(1)}, wantErr: ErrInvalidTransition},
+		{name: "cancelled", state: task.Cancelled, patch: TaskPatch{Memory: ptr(1)}, wantErr: ErrInvalidTransition},
+		{name: "scheduled", state: task.Scheduled, patch: TaskPatch{Memory: ptr(1)}, wantErr: ErrInvalidTransition},
+		{name: "invalid image", state: task.Running, patch: TaskPatch{Image: ptr("Not An Image")}, wantErr: ErrInvalidTask},
+		{name: "request above limit", state: task.Running, patch: TaskPatch{CpuLimit: ptr(0.5)}, wantErr: ErrInvalidTask},
+		{name: "negative memory", state: task.Pending, patch: TaskPatch{Memory: ptr(-1)}, wantErr: ErrInvalidTask},
+		{name: "node too small", state: task.Running, patch: TaskPatch{CpuRequest: ptr(8.0)}, wantErr: ErrInsufficientResources},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, r := newPatchTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			})
+			r.State = tt.state
+			before := *r
+			n := m.getNode(m.TaskWorkerMap[r.ID])
+			allocated := n.CpuAllocated
+
+			result, err := m.PatchTask(r.ID, tt.patch)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PatchTask error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if r.Image != before.Image || r.CpuRequest != before.CpuRequest || r.State != before.State {
+					t.Errorf("refused patch changed the task")
+				}
+				if n.CpuAllocated != allocated {
+					t.Errorf("refused patch changed the allocation from %v to %v", allocated, n.CpuAllocated)
+				}
+				if m.Pending.Len() != 0 {
+					t.Errorf("refused patch queued an update")
+				}
+				return
+			}
+
+			if result.Mode != tt.wantMode {
+				t.Errorf("mode = %s, want %s", result.Mode, tt.wantMode)
+			}
+			if result.Task.ID != r.ID || r.ContainerID != before.ContainerID {
+				t.Errorf("patch did not keep the task's identity")
+			}
+			wantQueued := 1
+			if tt.wantMode == PatchPending {
+				wantQueued = 0
+			}
+			if got := m.Pending.Len(); got != wantQueued {
+				t.Errorf("queued %d updates, want %d", got, wantQueued)
+			}
+		})
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		m, _ := newPatchTestManager(t, nil)
+		if _, err := m.PatchTask(uuid.New(), TaskPatch{}); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("PatchTask error = %v, want %v", err, ErrTaskNotFound)
+		}
+	})
+}
+
+func TestPatchTaskHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		state      task.State
+		id         string
+		body       string
+		want       int
+		wantFields []string
+	}{
+		{name: "in place", state: task.Running, body: `{"cpuRequest": 2}`, want: http.StatusAccepted},
+		{name: "unknown task", state: task.Running, id: uuid.NewString(), body: `{}`, want: http.StatusNotFound},
+		{name: "bad id", state: task.Running, id: "nope", body: `{}`, want: http.StatusBadRequest},
+		{name: "unknown field", state: task.Running, body: `{"name": "web"}`, want: http.StatusBadRequest},
+		{name: "terminal task", state: task.Completed, body: `{"cpuRequest": 2}`, want: http.StatusConflict},
+		{name: "invalid fields", state: task.Running, body: `{"memory": -1, "restartPolicy": "sometimes"}`, want: http.StatusBadRequest, wantFields: []string{"restartPolicy", "memory"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, r := newPatchTestManager(t, nil)
+			r.State = tt.state
+			a := newAuthTestApi(t, m)
+
+			id := tt.id
+			if id == "" {
+				id = r.ID.String()
+			}
+			rec := httptest.NewRecorder()
+			a.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/tasks/"+id, strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.wantFields == nil {
+				return
+			}
+
+			var resp ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decoding error response: %v", err)
+			}
+			var fields []string
+			for _, fe := range resp.Errors {
+				fields = append(fields, fe.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("field errors = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
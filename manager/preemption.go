@@ -0,0 +1,178 @@
+package manager
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/node"
+	"github.com/reversearrow/orchestrator/scheduler"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+// preempt looks for the node where stopping the fewest tasks of lower
+// priority than t would make room for it, and asks for those tasks to be
+// stopped. It reports whether room is being made for t, including by tasks
+// already being preempted. It must be called with m.mu held.
+func (m *Manager) preempt(t task.Task) bool {
+	var best *node.Node
+	var bestVictims []*task.Task
+	for _, n := range m.WorkerNodes {
+		freeing := m.preemptionsOn(n.Name)
+		if m.fitsAfter(t, n, freeing) {
+			return true
+		}
+
+		victims, ok := m.victimsOn(t, n, freeing)
+		if !ok {
+			continue
+		}
+		if best == nil || len(victims) < len(bestVictims) ||
+			(len(victims) == len(bestVictims) && victims[len(victims)-1].Priority < bestVictims[len(bestVictims)-1].Priority) {
+			best, bestVictims = n, victims
+		}
+	}
+	if best == nil {
+		return false
+	}
+
+	for _, v := range bestVictims {
+		m.displace(v, fmt.Sprintf("preempted by task %v", t.ID))
+		m.Logger.Printf("preempting task %v (priority %d) on %s for task %v (priority %d)\n", v.ID, v.Priority, best.Name, t.ID, t.Priority)
+	}
+	return true
+}
+
+// victimsOn picks the tasks on n to stop so that t fits, lowest priority and
+// then most recently started first. The last victim has the highest priority.
+func (m *Manager) victimsOn(t task.Task, n *node.Node, freeing []*task.Task) ([]*task.Task, bool) {
+	var candidates []*task.Task
+	for _, id := range m.WorkerTaskMap[n.Name] {
+		v, ok := m.TaskDb[id]
+		if !ok || m.TaskWorkerMap[id] != n.Name || v.Priority >= t.Priority {
+			continue
+		}
+		if v.State != task.Scheduled && v.State != task.Running {
+			continue
+		}
+		if _, ok := m.preempted[id]; ok {
+			continue
+		}
+		candidates = append(candidates, v)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Priority != candidates[j].Priority {
+			return candidates[i].Priority < candidates[j].Priority
+		}
+		return candidates[i].StartTime.After(candidates[j].StartTime)
+	})
+
+	var victims []*task.Task
+	for _, v := range candidates {
+		victims = append(victims, v)
+		if m.fitsAfter(t, n, append(slices.Clip(freeing), victims...)) {
+			return victims, true
+		}
+	}
+	return nil, false
+}
+
+// fitsAfter reports whether the scheduler would accept n for t once the
+// given tasks have released their resources.
+func (m *Manager) fitsAfter(t task.Task, n *node.Node, released []*task.Task) bool {
+	if len(released) == 0 {
+		return false
+	}
+
+	nc := *n
+	for _, r := range released {
+		nc.CpuAllocated -= r.CpuRequested()
+		nc.DiskAllocated -= r.Disk
+		nc.TaskCount--
+	}
+	nc.Placements = m.placements(n.Name, released)
+	return len(m.Scheduler.SelectCandidateNodes(t, []*node.Node{&nc})) > 0
+}
+
+// evictUntolerated stops the tasks on n that do not tolerate one of its
+// NoExecute taints. It must be called with m.mu held.
+func (m *Manager) evictUntolerated(n *node.Node) {
+	for _, id := range m.WorkerTaskMap[n.Name] {
+		t, ok := m.TaskDb[id]
+		if !ok || m.TaskWorkerMap[id] != n.Name || !task.ValidStateTransition(t.State, task.Stopping) {
+			continue
+		}
+		if _, ok := m.preempted[id]; ok {
+			continue
+		}
+
+		for _, taint := range n.Taints {
+			if taint.Effect == node.TaintNoExecute && !scheduler.Tolerates(*t, taint) {
+				m.displace(t, fmt.Sprintf("evicted by taint %s", taint))
+				m.Logger.Printf("evicting task %v from %s: taint %s is not tolerated\n", t.ID, n.Name, taint)
+				break
+			}
+		}
+	}
+}
+
+// displace asks for t to be stopped by the scheduler for the given reason.
+func (m *Manager) displace(t *task.Task, reason string) {
+	m.preempted[t.ID] = reason
+	tc := *t
+	tc.State = task.Stopping
+	m.Pending.Enqueue(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Stopping,
+		Timestamp: time.Now().UTC(),
+		Task:      tc,
+	})
+}
+
+func (m *Manager) preemptionsOn(name string) []*task.Task {
+	var tasks []*task.Task
+	for id := range m.preempted {
+		if m.TaskWorkerMap[id] != name {
+			continue
+		}
+		if t, ok := m.TaskDb[id]; ok {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+// finishPreemption handles a preempted or evicted task once its worker has
+// stopped it: it is either put back in the queue or failed, according to its
+// policy.
+func (m *Manager) finishPreemption(t *task.Task) {
+	reason := m.preempted[t.ID]
+	delete(m.preempted, t.ID)
+
+	if t.PreemptionPolicy == task.PreemptFail {
+		m.releaseResources(t)
+		t.Error = reason
+		t.FinishTime = time.Now().UTC()
+		m.setState(t, task.Failed, SourceScheduler, reason)
+		return
+	}
+
+	m.unassign(t)
+	m.retired[t.ID] = t.ContainerID
+
+	t.ContainerID = ""
+	t.Error = ""
+	t.StartTime = time.Time{}
+	t.FinishTime = time.Time{}
+	m.setState(t, task.Pending, SourceScheduler, fmt.Sprintf("%s, rescheduled", reason))
+
+	tc := *t
+	m.Pending.Enqueue(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Pending,
+		Timestamp: time.Now().UTC(),
+		Task:      tc,
+	})
+}
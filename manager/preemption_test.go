@@ -0,0 +1,128 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+type placedTask struct {
+	name     string
+	node     string
+	priority int
+	cpu      float64
+	started  time.Duration // before now
+}
+
+func TestPreemptVictims(t *testing.T) {
+	running := []placedTask{
+		{name: "w1-low-old", node: "w1:5555", priority: 0, cpu: 1, started: 2 * time.Hour},
+		{name: "w1-mid", node: "w1:5555", priority: 5, cpu: 1, started: time.Hour},
+		{name: "w2-a", node: "w2:5555", priority: 1, cpu: 1, started: time.Hour},
+		{name: "w2-b", node: "w2:5555", priority: 1, cpu: 1, started: time.Minute},
+	}
+
+	tests := []struct {
+		name     string
+		priority int
+		cpu      float64
+		extra    []placedTask
+		want     []string
+		wantOK   bool
+	}{
+		{
+			name:     "equal victim counts prefer the lower priority",
+			priority: 10, cpu: 1,
+			want: []string{"w1-low-old"}, wantOK: true,
+		},
+		{
+			name:     "newest task first within a priority",
+			priority: 10, cpu: 2,
+			want: []string{"w2-b", "w2-a"}, wantOK: true,
+		},
+		{
+			name:     "only lower priority tasks are victims",
+			priority: 1, cpu: 1,
+			want: []string{"w1-low-old"}, wantOK: true,
+		},
+		{
+			name:     "fewest victims wins over lower priority",
+			priority: 10, cpu: 1,
+			extra: []placedTask{{name: "w1-low-new", node: "w1:5555", priority: 0, cpu: 0, started: time.Second}},
+			want:  []string{"w2-b"}, wantOK: true,
+		},
+		{
+			name:     "nothing to preempt",
+			priority: 0, cpu: 1,
+		},
+		{
+			name:     "does not fit even with every victim",
+			priority: 10, cpu: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			for _, n := range m.WorkerNodes {
+				n.Cores = 2
+				n.Disk = 1 << 30
+			}
+
+			names := make(map[uuid.UUID]string)
+			for _, p := range append(append([]placedTask(nil), running...), tt.extra...) {
+				v := &task.Task{
+					ID:         uuid.New(),
+					Name:       p.name,
+					Namespace:  task.DefaultNamespace,
+					State:      task.Running,
+					Priority:   p.priority,
+					CpuRequest: p.cpu,
+					StartTime:  time.Now().Add(-p.started),
+				}
+				m.TaskDb[v.ID] = v
+				m.TaskWorkerMap[v.ID] = p.node
+				m.WorkerTaskMap[p.node] = append(m.WorkerTaskMap[p.node], v.ID)
+				m.reserveResources(m.getNode(p.node), v)
+				names[v.ID] = p.name
+			}
+
+			pending := task.Task{ID: uuid.New(), Priority: tt.priority, CpuRequest: tt.cpu}
+			if ok := m.preempt(pending); ok != tt.wantOK {
+				t.Fatalf("preempt() = %v, want %v", ok, tt.wantOK)
+			}
+
+			var got []string
+			for {
+				te, ok := m.Pending.Dequeue()
+				if !ok {
+					break
+				}
+				if te.State != task.Stopping {
+					t.Errorf("queued a %v event, want Stopping", te.State)
+				}
+				got = append(got, names[te.Task.ID])
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("preempted %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("preempted %v, want %v", got, tt.want)
+				}
+			}
+			if len(m.preempted) != len(tt.want) {
+				t.Errorf("%d tasks marked as preempted, want %d", len(m.preempted), len(tt.want))
+			}
+
+			// Room is already being made, so asking again stops nothing more.
+			if tt.wantOK {
+				if !m.preempt(pending) || m.Pending.Len() != 0 {
+					t.Errorf("preempt() again queued %d more stops", m.Pending.Len())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package manager
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+const (
+	SortByID         = "id"
+	SortByStartTime  = "startTime"
+	SortByFinishTime = "finishTime"
+)
+
+const maxPageSize = 1000
+
+// TaskQuery selects, orders and pages tasks. Without a limit every matching
+// task is returned.
+type TaskQuery struct {
+	Namespace string
+	States    []task.State
+	Image     string
+	Name      string
+	Worker    string
+	Labels    map[string]string
+	SortBy    string
+	Desc      bool
+	Limit     int
+	Cursor    string
+}
+
+// ParseTaskQuery reads a query from URL parameters:
+//
+//	namespace=team-a  state=Running,Failed  image=nginx:1.25  name=web  worker=host:port
+//	label=app=web (repeatable)  sort=startTime|-startTime|finishTime|-finishTime
+//	limit=100  cursor=<value of the previous page's X-Next-Cursor header>
+func ParseTaskQuery(v url.Values) (TaskQuery, error) {
+	q := TaskQuery{
+		Namespace: v.Get("namespace"),
+		Image:     v.Get("image"),
+		Name:      v.Get("name"),
+		Worker:    v.Get("worker"),
+		SortBy:    SortByID,
+		Cursor:    v.Get("cursor"),
+	}
+
+	for _, states := range v["state"] {
+		for _, name := range strings.Split(states, ",") {
+			var s task.State
+			if err := s.UnmarshalText([]byte(name)); err != nil {
+				return TaskQuery{}, err
+			}
+			q.States = append(q.States, s)
+		}
+	}
+
+	for _, labels := range v["label"] {
+		for _, l := range strings.Split(labels, ",") {
+			key, value, ok := strings.Cut(l, "=")
+			if !ok || key == "" {
+				return TaskQuery{}, fmt.Errorf("invalid label filter %q, expected key=value", l)
+			}
+			if q.Labels == nil {
+				q.Labels = make(map[string]string)
+			}
+			q.Labels[key] = value
+		}
+	}
+
+	if sortBy := v.Get("sort"); sortBy != "" {
+		q.Desc = strings.HasPrefix(sortBy, "-")
+		q.SortBy = strings.TrimPrefix(sortBy, "-")
+		switch q.SortBy {
+		case SortByID, SortByStartTime, SortByFinishTime:
+		default:
+			return TaskQuery{}, fmt.Errorf("invalid sort %q", sortBy)
+		}
+	}
+
+	if limit := v.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxPageSize {
+			return TaskQuery{}, fmt.Errorf("invalid limit %q, expected 1 to %d", limit, maxPageSize)
+		}
+		q.Limit = n
+	}
+
+	return q, nil
+}
+
+func (q TaskQuery) matches(t *task.Task, worker string) bool {
+	if q.Namespace != "" && t.Namespace != q.Namespace {
+		return false
+	}
+	if len(q.States) > 0 {
+		found := false
+		for _, s := range q.States {
+			if t.State == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if q.Image != "" && t.Image != q.Image {
+		return false
+	}
+	if q.Name != "" && t.Name != q.Name {
+		return false
+	}
+	if q.Worker != "" && worker != q.Worker {
+		return false
+	}
+	for k, v := range q.Labels {
+		if tv, ok := t.Labels[k]; !ok || tv != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (q TaskQuery) sortKey(t *task.Task) time.Time {
+	switch q.SortBy {
+	case SortByStartTime:
+		return t.StartTime
+	case SortByFinishTime:
+		return t.FinishTime
+	}
+	return time.Time{}
+}
+
+// less orders tasks by the sort key, breaking ties by ID so that the order,
+// and therefore every cursor, is stable.
+func (q TaskQuery) less(a time.Time, aID uuid.UUID, b time.Time, bID uuid.UUID) bool {
+	if !a.Equal(b) {
+		if q.Desc {
+			return a.After(b)
+		}
+		return a.Before(b)
+	}
+	if q.Desc {
+		return aID.String() > bID.String()
+	}
+	return aID.String() < bID.String()
+}
+
+type cursor struct {
+	key time.Time
+	id  uuid.UUID
+}
+
+func (q TaskQuery) encodeCursor(t *task.Task) string {
+	raw := fmt.Sprintf("%s|%t|%s|%s", q.SortBy, q.Desc, q.sortKey(t).Format(time.RFC3339Nano), t.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func (q TaskQuery) decodeCursor() (*cursor, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if parts[0] != q.SortBy || parts[1] != strconv.FormatBool(q.Desc) {
+		return nil, fmt.Errorf("cursor does not match the requested sort order")
+	}
+	key, err := time.Parse(time.RFC3339Nano, parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	id, err := uuid.Parse(parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return &cursor{key: key, id: id}, nil
+}
+
+// QueryTasks returns one page of tasks matching q and the cursor of the next
+// page, which is empty on the last page.
+func (m *Manager) QueryTasks(q TaskQuery) ([]*task.Task, string, error) {
+	after, err := q.decodeCursor()
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+
+	m.mu.Lock()
+	var tasks []*task.Task
+	for _, t := range m.TaskDb {
+		if !q.matches(t, m.TaskWorkerMap[t.ID]) {
+			continue
+		}
+		tc := *t
+		tasks = append(tasks, &tc)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return q.less(q.sortKey(tasks[i]), tasks[i].ID, q.sortKey(tasks[j]), tasks[j].ID)
+	})
+
+	if after != nil {
+		start := sort.Search(len(tasks), func(i int) bool {
+			return q.less(after.key, after.id, q.sortKey(tasks[i]), tasks[i].ID)
+		})
+		tasks = tasks[start:]
+	}
+
+	if q.Limit == 0 || len(tasks) <= q.Limit {
+		return tasks, "", nil
+	}
+
+	page := tasks[:q.Limit]
+	return page, q.encodeCursor(page[len(page)-1]), nil
+}
+
+// GetAllTasks returns copies of every task, or only of those in the given
+// namespaces.
+func (m *Manager) GetAllTasks(namespaces ...string) []*task.Task {
+	if len(namespaces) == 0 {
+		tasks, _, _ := m.QueryTasks(TaskQuery{})
+		return tasks
+	}
+
+	var tasks []*task.Task
+	for _, ns := range namespaces {
+		page, _, _ := m.QueryTasks(TaskQuery{Namespace: ns})
+		tasks = append(tasks, page...)
+	}
+	return tasks
+}
+
+func (m *Manager) GetTask(id uuid.UUID) (*task.Task, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.TaskDb[id]
+	if !ok {
+		return nil, false
+	}
+	tc := *t
+	return &tc, true
+}
@@ -0,0 +1,227 @@
+package manager
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/reversearrow/orchestrator/task"
+)
+
+func TestGetAllTasks(t *testing.T) {
+	m := newTestManager(t)
+	addTestTask(m, "a", task.Running, 0, 0)
+	addTestTask(m, "a", task.Pending, 0, 0)
+	addTestTask(m, "b", task.Running, 0, 0)
+	addTestTask(m, "c", task.Running, 0, 0)
+
+	tests := []struct {
+		namespaces []string
+		want       int
+	}{
+		{want: 4},
+		{namespaces: []string{"a"}, want: 2},
+		{namespaces: []string{"a", "c"}, want: 3},
+		{namespaces: []string{"d"}, want: 0},
+	}
+
+	for _, tt := range tests {
+		got := m.GetAllTasks(tt.namespaces...)
+		if len(got) != tt.want {
+			t.Errorf("GetAllTasks(%q) returned %d tasks, want %d", tt.namespaces, len(got), tt.want)
+		}
+		for _, tk := range got {
+			if tk == m.TaskDb[tk.ID] {
+				t.Errorf("GetAllTasks(%q) returned the stored task %v, not a copy", tt.namespaces, tk.ID)
+			}
+		}
+	}
+}
+
+func TestParseTaskQueryInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "unknown state", query: "state=Sleeping"},
+		{name: "label without value", query: "label=app"},
+		{name: "label without key", query: "label==web"},
+		{name: "unknown sort", query: "sort=name"},
+		{name: "zero limit", query: "limit=0"},
+		{name: "negative limit", query: "limit=-1"},
+		{name: "limit too large", query: "limit=1001"},
+		{name: "limit not a number", query: "limit=ten"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := url.ParseQuery(tt.query)
+			if _, err := ParseTaskQuery(v); err == nil {
+				t.Errorf("ParseTaskQuery(%q) succeeded", tt.query)
+			}
+		})
+	}
+}
+
+func TestQueryTasksFilters(t *testing.T) {
+	m := newTestManager(t)
+	web := addTestTask(m, "a", task.Running, 0, 0)
+	web.Name, web.Image, web.Labels = "web", "nginx", map[string]string{"app": "web", "tier": "front"}
+	m.TaskWorkerMap[web.ID] = "w1:5555"
+	db := addTestTask(m, "a", task.Failed, 0, 0)
+	db.Name, db.Image, db.Labels = "db", "postgres", map[string]string{"app": "db"}
+	m.TaskWorkerMap[db.ID] = "w2:5555"
+	other := addTestTask(m, "b", task.Running, 0, 0)
+	other.Name, other.Image = "web", "nginx"
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{query: "", want: 3},
+		{query: "namespace=a", want: 2},
+		{query: "state=Running", want: 2},
+		{query: "state=Running,Failed&namespace=a", want: 2},
+		{query: "state=Pending", want: 0},
+		{query: "image=nginx", want: 2},
+		{query: "name=db", want: 1},
+		{query: "worker=w2:5555", want: 1},
+		{query: "label=app=web", want: 1},
+		{query: "label=app=web,tier=back", want: 0},
+		{query: "label=app=web&label=tier=front", want: 1},
+	}
+
+	for _, tt := range tests {
+		v, _ := url.ParseQuery(tt.query)
+		q, err := ParseTaskQuery(v)
+		if err != nil {
+			t.Fatalf("ParseTaskQuery(%q): %v", tt.query, err)
+		}
+		got, next, err := m.QueryTasks(q)
+		if err != nil {
+			t.Fatalf("QueryTasks(%q): %v", tt.query, err)
+		}
+		if len(got) != tt.want || next != "" {
+			t.Errorf("QueryTasks(%q) returned %d tasks and cursor %q, want %d and none", tt.query, len(got), next, tt.want)
+		}
+	}
+}
+
+func TestQueryTasksPagination(t *testing.T) {
+	m := newTestManager(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 7; i++ {
+		tk := addTestTask(m, "a", task.Running, 0, 0)
+		// Pairs of tasks share a start time so ties are broken by ID.
+		tk.StartTime = start.Add(time.Duration(i/2) * time.Minute)
+	}
+
+	for _, sortBy := range []string{"id", "startTime", "-startTime"} {
+		v := url.Values{"sort": {sortBy}}
+		q, err := ParseTaskQuery(v)
+		if err != nil {
+			t.Fatalf("ParseTaskQuery(%v): %v", v, err)
+		}
+		all, _, _ := m.QueryTasks(q)
+
+		q.Limit = 3
+		var paged []*task.Task
+		for pages := 0; ; pages++ {
+			if pages > len(all) {
+				t.Fatalf("sort=%s: pagination did not terminate", sortBy)
+			}
+			page, next, err := m.QueryTasks(q)
+			if err != nil {
+				t.Fatalf("sort=%s: QueryTasks: %v", sortBy, err)
+			}
+			paged = append(paged, page...)
+			if next == "" {
+				break
+			}
+			q.Cursor = next
+		}
+
+		if len(paged) != len(all) {
+			t.Fatalf("sort=%s: paged through %d tasks, want %d", sortBy, len(paged), len(all))
+		}
+		for i := range all {
+			if paged[i].ID != all[i].ID {
+				t.Errorf("sort=%s: task %d is %v, want %v", sortBy, i, paged[i].ID, all[i].ID)
+			}
+		}
+	}
+}
+
+func TestQueryTasksInvalidCursor(t *testing.T) {
+	m := newTestManager(t)
+	for i := 0; i < 3; i++ {
+		addTestTask(m, "a", task.Running, 0, 0)
+	}
+	_, next, err := m.QueryTasks(TaskQuery{SortBy: SortByID, Limit: 1})
+	if err != nil || next == "" {
+		t.Fatalf("QueryTasks() = cursor %q, %v, want a next page", next, err)
+	}
+
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name   string
+		sortBy string
+		desc   bool
+		cursor string
+	}{
+		{name: "not base64", sortBy: SortByID, cursor: "!!!"},
+		{name: "too few fields", sortBy: SortByID, cursor: encode("id|false|x")},
+		{name: "bad time", sortBy: SortByID, cursor: encode("id|false|yesterday|" + m.GetAllTasks()[0].ID.String())},
+		{name: "bad id", sortBy: SortByID, cursor: encode("id|false|0001-01-01T00:00:00Z|nope")},
+		{name: "other sort key", sortBy: SortByStartTime, cursor: next},
+		{name: "other direction", sortBy: SortByID, desc: true, cursor: next},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := m.QueryTasks(TaskQuery{SortBy: tt.sortBy, Desc: tt.desc, Limit: 1, Cursor: tt.cursor})
+			if !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("QueryTasks() error = %v, want %v", err, ErrInvalidQuery)
+			}
+		})
+	}
+}
+
+func TestGetTasksHandler(t *testing.T) {
+	m := newTestManager(t)
+	for i := 0; i < 3; i++ {
+		addTestTask(m, "a", task.Running, 0, 0)
+	}
+	addTestTask(m, "b", task.Running, 0, 0)
+	a := newAuthTestApi(t, m)
+
+	tests := []struct {
+		path     string
+		want     int
+		wantNext bool
+	}{
+		{path: "/tasks", want: http.StatusOK},
+		{path: "/tasks?limit=2", want: http.StatusOK, wantNext: true},
+		{path: "/namespaces/a/tasks?limit=3", want: http.StatusOK},
+		{path: "/tasks?limit=0", want: http.StatusBadRequest},
+		{path: "/tasks?limit=5000", want: http.StatusBadRequest},
+		{path: "/tasks?cursor=garbage", want: http.StatusBadRequest},
+		{path: "/tasks?state=Sleeping", want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		a.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d: %s", tt.path, rec.Code, tt.want, rec.Body)
+		}
+		if next := rec.Header().Get("X-Next-Cursor") != ""; next != tt.wantNext {
+			t.Errorf("GET %s returned a next cursor = %v, want %v", tt.path, next, tt.wantNext)
+		}
+	}
+}
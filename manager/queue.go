@@ -0,0 +1,105 @@
+package manager
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/reversearrow/orchestrator/task"
+)
+
+// TaskQueue holds the events waiting to be sent to workers. Stop and update
+// events for tasks that are already placed come first, then new tasks by
+// descending priority, in submission order within a priority. An event can be
+// put back with a delay, e.g. when it could not be scheduled, so that it does
+// not block the events behind it. The zero value is an empty queue.
+type TaskQueue struct {
+	ready   eventHeap
+	delayed []queuedEvent
+	seq     uint64
+}
+
+type queuedEvent struct {
+	event     task.TaskEvent
+	seq       uint64
+	notBefore time.Time
+}
+
+func (q *TaskQueue) Enqueue(te task.TaskEvent) {
+	q.seq++
+	heap.Push(&q.ready, queuedEvent{event: te, seq: q.seq})
+}
+
+// EnqueueAfter adds te to the queue once d has passed.
+func (q *TaskQueue) EnqueueAfter(te task.TaskEvent, d time.Duration) {
+	q.seq++
+	q.delayed = append(q.delayed, queuedEvent{event: te, seq: q.seq, notBefore: time.Now().Add(d)})
+}
+
+// Dequeue removes the first event that is ready to be sent.
+func (q *TaskQueue) Dequeue() (task.TaskEvent, bool) {
+	q.promote()
+	if q.ready.Len() == 0 {
+		return task.TaskEvent{}, false
+	}
+	return heap.Pop(&q.ready).(queuedEvent).event, true
+}
+
+// Len counts every queued event, including delayed ones.
+func (q *TaskQueue) Len() int {
+	return q.ready.Len() + len(q.delayed)
+}
+
+// Ready reports whether an event can be dequeued now.
+func (q *TaskQueue) Ready() bool {
+	q.promote()
+	return q.ready.Len() > 0
+}
+
+func (q *TaskQueue) promote() {
+	now := time.Now()
+	kept := q.delayed[:0]
+	for _, e := range q.delayed {
+		if now.Before(e.notBefore) {
+			kept = append(kept, e)
+			continue
+		}
+		heap.Push(&q.ready, e)
+	}
+	q.delayed = kept
+}
+
+type eventHeap []queuedEvent
+
+func (h eventHeap) Len() int { return len(h) }
+
+func (h eventHeap) Less(i, j int) bool {
+	ci, cj := isControlEvent(h[i].event), isControlEvent(h[j].event)
+	if ci != cj {
+		return ci
+	}
+	if pi, pj := h[i].event.Task.Priority, h[j].event.Task.Priority; pi != pj {
+		return pi > pj
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h eventHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *eventHeap) Push(x any) { *h = append(*h, x.(queuedEvent)) }
+
+func (h *eventHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// isControlEvent reports whether te acts on a task that is already placed
+// rather than asking for a new placement.
+func isControlEvent(te task.TaskEvent) bool {
+	switch te.State {
+	case task.Stopping, task.Running, task.Restarting:
+		return true
+	}
+	return false
+}
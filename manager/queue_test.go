@@ -0,0 +1,110 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+func testEvent(name string, state task.State, priority int) task.TaskEvent {
+	return task.TaskEvent{
+		ID:    uuid.New(),
+		State: state,
+		Task:  task.Task{ID: uuid.New(), Name: name, State: state, Priority: priority},
+	}
+}
+
+func drain(q interface {
+	Dequeue() (task.TaskEvent, bool)
+}) []string {
+	var names []string
+	for {
+		te, ok := q.Dequeue()
+		if !ok {
+			return names
+		}
+		names = append(names, te.Task.Name)
+	}
+}
+
+func TestTaskQueueOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []task.TaskEvent
+		want   []string
+	}{
+		{
+			name: "fifo within a priority",
+			events: []task.TaskEvent{
+				testEvent("a", task.Pending, 0),
+				testEvent("b", task.Pending, 0),
+				testEvent("c", task.Pending, 0),
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "higher priority first",
+			events: []task.TaskEvent{
+				testEvent("low", task.Pending, -1),
+				testEvent("mid", task.Pending, 0),
+				testEvent("high", task.Pending, 10),
+				testEvent("mid2", task.Pending, 0),
+			},
+			want: []string{"high", "mid", "mid2", "low"},
+		},
+		{
+			name: "control events first",
+			events: []task.TaskEvent{
+				testEvent("high", task.Pending, 10),
+				testEvent("stop", task.Stopping, 0),
+				testEvent("update", task.Running, 0),
+				testEvent("replace", task.Restarting, 0),
+			},
+			want: []string{"stop", "update", "replace", "high"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q TaskQueue
+			for _, te := range tt.events {
+				q.Enqueue(te)
+			}
+			if q.Len() != len(tt.events) {
+				t.Errorf("Len() = %d, want %d", q.Len(), len(tt.events))
+			}
+			got := drain(&q)
+			if len(got) != len(tt.want) {
+				t.Fatalf("dequeued %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("dequeued %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTaskQueueDelayed(t *testing.T) {
+	var q TaskQueue
+	q.EnqueueAfter(testEvent("later", task.Pending, 10), time.Hour)
+	q.EnqueueAfter(testEvent("now", task.Pending, 0), 0)
+	q.Enqueue(testEvent("queued", task.Pending, 5))
+
+	if q.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", q.Len())
+	}
+	got := drain(&q)
+	if len(got) != 2 || got[0] != "queued" || got[1] != "now" {
+		t.Errorf("dequeued %v, want [queued now]", got)
+	}
+	if q.Ready() {
+		t.Error("Ready() = true with only a delayed event")
+	}
+	if q.Len() != 1 {
+		t.Errorf("Len() = %d, want the delayed event counted", q.Len())
+	}
+}
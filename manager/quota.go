@@ -0,0 +1,167 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/reversearrow/orchestrator/task"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota limits what the live tasks of a namespace may use in total. A zero
+// limit is unlimited.
+type Quota struct {
+	Namespace string  `json:"namespace"`
+	MaxTasks  int     `json:"maxTasks,omitempty"`
+	Memory    int     `json:"memory,omitempty"`
+	Cpu       float64 `json:"cpu,omitempty"`
+	Disk      int     `json:"disk,omitempty"`
+}
+
+type QuotaUsage struct {
+	Tasks  int     `json:"tasks"`
+	Memory int     `json:"memory"`
+	Cpu    float64 `json:"cpu"`
+	Disk   int     `json:"disk"`
+}
+
+func (u *QuotaUsage) add(t task.Task) {
+	u.Tasks++
+	u.Memory += t.Memory
+	u.Cpu += t.CpuRequested()
+	u.Disk += t.Disk
+}
+
+type QuotaStatus struct {
+	Namespace string     `json:"namespace"`
+	Limits    *Quota     `json:"limits,omitempty"`
+	Used      QuotaUsage `json:"used"`
+}
+
+func LoadQuotas(path string) ([]Quota, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading quotas: %w", err)
+	}
+
+	var quotas []Quota
+	if err := json.Unmarshal(data, &quotas); err != nil {
+		return nil, fmt.Errorf("error decoding quotas: %w", err)
+	}
+
+	for _, q := range quotas {
+		if !namespacePattern.MatchString(q.Namespace) {
+			return nil, fmt.Errorf("quota has invalid namespace %q", q.Namespace)
+		}
+		if q.MaxTasks < 0 || q.Memory < 0 || q.Cpu < 0 || q.Disk < 0 {
+			return nil, fmt.Errorf("quota for namespace %q has negative limits", q.Namespace)
+		}
+	}
+
+	return quotas, nil
+}
+
+func (m *Manager) SetQuotas(quotas []Quota) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Quotas = make(map[string]Quota, len(quotas))
+	for _, q := range quotas {
+		m.Quotas[q.Namespace] = q
+	}
+}
+
+// usage sums what the live tasks of namespace request.
+func (m *Manager) usage(namespace string) QuotaUsage {
+	var u QuotaUsage
+	for _, t := range m.TaskDb {
+		if t.Namespace == namespace && !task.IsTerminal(t.State) {
+			u.add(*t)
+		}
+	}
+	return u
+}
+
+// checkQuota reports whether the namespace can take on the change from old
+// to updated on top of its current usage plus pending, which holds what has
+// been admitted but is not in TaskDb yet. A nil old admits a new task.
+func (m *Manager) checkQuota(old *task.Task, updated task.Task, pending QuotaUsage) error {
+	q, ok := m.Quotas[updated.Namespace]
+	if !ok {
+		return nil
+	}
+
+	u := m.usage(updated.Namespace)
+	u.Tasks += pending.Tasks
+	u.Memory += pending.Memory
+	u.Cpu += pending.Cpu
+	u.Disk += pending.Disk
+
+	u.add(updated)
+	if old != nil {
+		u.Tasks--
+		u.Memory -= old.Memory
+		u.Cpu -= old.CpuRequested()
+		u.Disk -= old.Disk
+	}
+
+	switch {
+	case q.MaxTasks > 0 && u.Tasks > q.MaxTasks:
+		return fmt.Errorf("%w: namespace %q is limited to %d tasks", ErrQuotaExceeded, q.Namespace, q.MaxTasks)
+	case q.Memory > 0 && u.Memory > q.Memory:
+		return fmt.Errorf("%w: namespace %q would use %d of %d bytes of memory", ErrQuotaExceeded, q.Namespace, u.Memory, q.Memory)
+	case q.Cpu > 0 && u.Cpu > q.Cpu:
+		return fmt.Errorf("%w: namespace %q would use %.2f of %.2f cpus", ErrQuotaExceeded, q.Namespace, u.Cpu, q.Cpu)
+	case q.Disk > 0 && u.Disk > q.Disk:
+		return fmt.Errorf("%w: namespace %q would use %d of %d bytes of disk", ErrQuotaExceeded, q.Namespace, u.Disk, q.Disk)
+	}
+	return nil
+}
+
+func (m *Manager) GetQuotaStatus(namespace string) QuotaStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.quotaStatus(namespace)
+}
+
+func (m *Manager) quotaStatus(namespace string) QuotaStatus {
+	s := QuotaStatus{
+		Namespace: namespace,
+		Used:      m.usage(namespace),
+	}
+	if q, ok := m.Quotas[namespace]; ok {
+		s.Limits = &q
+	}
+	return s
+}
+
+// GetQuotaStatuses reports usage for every namespace with a quota or with
+// live tasks.
+func (m *Manager) GetQuotaStatuses() []QuotaStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	namespaces := make(map[string]bool)
+	for ns := range m.Quotas {
+		namespaces[ns] = true
+	}
+	for _, t := range m.TaskDb {
+		if !task.IsTerminal(t.State) {
+			namespaces[t.Namespace] = true
+		}
+	}
+
+	statuses := make([]QuotaStatus, 0, len(namespaces))
+	for ns := range namespaces {
+		statuses = append(statuses, m.quotaStatus(ns))
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Namespace < statuses[j].Namespace
+	})
+	return statuses
+}
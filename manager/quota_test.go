@@ -0,0 +1,150 @@
+package manager
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+
+	m, err := NewManager(log.New(io.Discard, "", 0), http.DefaultClient, []string{"w1:5555", "w2:5555"})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	return m
+}
+
+func addTestTask(m *Manager, ns string, state task.State, cpu float64, memory int) *task.Task {
+	t := &task.Task{
+		ID:         uuid.New(),
+		Namespace:  ns,
+		State:      state,
+		CpuRequest: cpu,
+		Memory:     memory,
+	}
+	m.TaskDb[t.ID] = t
+	return t
+}
+
+func TestUsage(t *testing.T) {
+	m := newTestManager(t)
+	addTestTask(m, "a", task.Pending, 1, 100)
+	addTestTask(m, "a", task.Running, 0.5, 50)
+	addTestTask(m, "a", task.Lost, 0.25, 25)
+	addTestTask(m, "a", task.Completed, 4, 400)
+	addTestTask(m, "a", task.Cancelled, 4, 400)
+	addTestTask(m, "b", task.Running, 2, 200)
+
+	want := QuotaUsage{Tasks: 3, Memory: 175, Cpu: 1.75}
+	if got := m.usage("a"); got != want {
+		t.Errorf("usage(a) = %+v, want %+v", got, want)
+	}
+}
+
+func TestCheckQuota(t *testing.T) {
+	tests := []struct {
+		name    string
+		quota   Quota
+		old     *task.Task
+		updated task.Task
+		pending QuotaUsage
+		wantErr bool
+	}{
+		{
+			name:    "no quota",
+			quota:   Quota{Namespace: "other", MaxTasks: 1},
+			updated: task.Task{Namespace: "a", Memory: 1 << 30},
+		},
+		{
+			name:    "fits",
+			quota:   Quota{Namespace: "a", MaxTasks: 3, Memory: 300, Cpu: 2},
+			updated: task.Task{Namespace: "a", Memory: 200, CpuRequest: 1},
+		},
+		{
+			name:    "too many tasks",
+			quota:   Quota{Namespace: "a", MaxTasks: 2},
+			updated: task.Task{Namespace: "a"},
+			wantErr: true,
+		},
+		{
+			name:    "too much memory",
+			quota:   Quota{Namespace: "a", Memory: 250},
+			updated: task.Task{Namespace: "a", Memory: 200},
+			wantErr: true,
+		},
+		{
+			name:    "limit only counts as cpu request",
+			quota:   Quota{Namespace: "a", Cpu: 2},
+			updated: task.Task{Namespace: "a", CpuLimit: 1.5},
+			wantErr: true,
+		},
+		{
+			name:    "pending usage counts",
+			quota:   Quota{Namespace: "a", MaxTasks: 3},
+			updated: task.Task{Namespace: "a"},
+			pending: QuotaUsage{Tasks: 1},
+			wantErr: true,
+		},
+		{
+			name:    "update replaces the old task's usage",
+			quota:   Quota{Namespace: "a", Memory: 250},
+			old:     &task.Task{Namespace: "a", Memory: 100},
+			updated: task.Task{Namespace: "a", Memory: 200},
+		},
+		{
+			name:    "update beyond the quota",
+			quota:   Quota{Namespace: "a", Memory: 250},
+			old:     &task.Task{Namespace: "a", Memory: 100},
+			updated: task.Task{Namespace: "a", Memory: 300},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			m.SetQuotas([]Quota{tt.quota})
+			addTestTask(m, "a", task.Running, 0.5, 50)
+			addTestTask(m, "a", task.Pending, 0.5, 50)
+			addTestTask(m, "a", task.Failed, 8, 800)
+
+			err := m.checkQuota(tt.old, tt.updated, tt.pending)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkQuota error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrQuotaExceeded) {
+				t.Errorf("checkQuota error = %v, want ErrQuotaExceeded", err)
+			}
+		})
+	}
+}
+
+func TestAddTaskBatchQuota(t *testing.T) {
+	m := newTestManager(t)
+	m.SetQuotas([]Quota{{Namespace: "a", MaxTasks: 2}})
+	addTestTask(m, "a", task.Running, 0, 0)
+
+	events := make([]task.TaskEvent, 2)
+	for i := range events {
+		id := uuid.New()
+		events[i] = task.TaskEvent{ID: uuid.New(), State: task.Pending, Task: task.Task{ID: id, Namespace: "a", State: task.Pending}}
+	}
+
+	errs, ok := m.AddTaskBatch(events, nil)
+	if ok {
+		t.Fatal("AddTaskBatch accepted a batch beyond the quota")
+	}
+	if errs[0] != nil || !errors.Is(errs[1], ErrQuotaExceeded) {
+		t.Errorf("AddTaskBatch errors = %v, want the second event over quota", errs)
+	}
+	if m.Pending.Len() != 0 {
+		t.Errorf("rejected batch queued %d events", m.Pending.Len())
+	}
+}
@@ -0,0 +1,173 @@
+package manager
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/container/docker"
+	"github.com/reversearrow/orchestrator/node"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+var namespacePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+var restartPolicies = []string{"", "no", "always", "unless-stopped", "on-failure"}
+
+var preemptionPolicies = []string{"", task.PreemptReschedule, task.PreemptFail}
+
+var tolerationOperators = []string{"", task.TolerationEqual, task.TolerationExists}
+
+var taintEffects = []string{"", node.TaintNoSchedule, node.TaintPreferNoSchedule, node.TaintNoExecute}
+
+var pullPolicies = []string{"", docker.PullAlways, docker.PullIfNotPresent, docker.PullNever}
+
+// FieldError describes a problem with a single field of a request, named by
+// its JSON path.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every field error found in a request. It matches
+// ErrInvalidTask with errors.Is.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fmt.Sprintf("%s: %s", fe.Field, fe.Message)
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalidTask, strings.Join(msgs, "; "))
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidTask
+}
+
+// ValidateTaskEvent checks that te is a well formed submission of a new task.
+func ValidateTaskEvent(te task.TaskEvent) error {
+	var errs []FieldError
+	if te.State != task.Pending {
+		errs = append(errs, FieldError{"state", fmt.Sprintf("must be %s, got %s", task.Pending, te.State)})
+	}
+	if te.Task.State != task.Pending {
+		errs = append(errs, FieldError{"task.state", fmt.Sprintf("must be %s, got %s", task.Pending, te.Task.State)})
+	}
+	if te.Task.ContainerID != "" {
+		errs = append(errs, FieldError{"task.containerId", "must not be set on submission"})
+	}
+	if te.Task.PullProgress != nil {
+		errs = append(errs, FieldError{"task.pullProgress", "must not be set on submission"})
+	}
+	errs = append(errs, validateTaskSpec(te.Task, "task.")...)
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+func validateTaskSpec(t task.Task, prefix string) []FieldError {
+	var errs []FieldError
+	add := func(field, msg string) {
+		errs = append(errs, FieldError{prefix + field, msg})
+	}
+
+	if t.ID == uuid.Nil {
+		add("id", "is required")
+	}
+	if !namespacePattern.MatchString(t.Namespace) {
+		add("namespace", fmt.Sprintf("invalid namespace %q, expected a lowercase DNS label", t.Namespace))
+	}
+	if t.Image == "" {
+		add("image", "is required")
+	} else if _, err := reference.ParseNormalizedNamed(t.Image); err != nil {
+		add("image", fmt.Sprintf("invalid reference: %v", err))
+	}
+	if !slices.Contains(pullPolicies, t.ImagePullPolicy) {
+		add("imagePullPolicy", fmt.Sprintf("unknown pull policy %q", t.ImagePullPolicy))
+	}
+	if !slices.Contains(restartPolicies, t.RestartPolicy) {
+		add("restartPolicy", fmt.Sprintf("unknown restart policy %q", t.RestartPolicy))
+	}
+	if !slices.Contains(preemptionPolicies, t.PreemptionPolicy) {
+		add("preemptionPolicy", fmt.Sprintf("unknown preemption policy %q", t.PreemptionPolicy))
+	}
+	if t.CpuRequest < 0 {
+		add("cpuRequest", "must not be negative")
+	}
+	if t.CpuLimit < 0 {
+		add("cpuLimit", "must not be negative")
+	}
+	if t.CpuLimit > 0 && t.CpuRequest > t.CpuLimit {
+		add("cpuRequest", "must not exceed cpuLimit")
+	}
+	if t.Memory < 0 {
+		add("memory", "must not be negative")
+	}
+	if t.Disk < 0 {
+		add("disk", "must not be negative")
+	}
+	for k := range t.Labels {
+		if strings.TrimSpace(k) == "" {
+			add("labels", "keys must not be empty")
+			break
+		}
+	}
+	if err := node.ValidateLabels(t.NodeSelector); err != nil {
+		add("nodeSelector", err.Error())
+	}
+	if t.Affinity != nil {
+		errs = append(errs, validateAffinityTerms(t.Affinity.Node, prefix+"affinity.node")...)
+		errs = append(errs, validateAffinityTerms(t.Affinity.TaskAnti, prefix+"affinity.taskAnti")...)
+	}
+	for i, tol := range t.Tolerations {
+		field := fmt.Sprintf("tolerations[%d]", i)
+		if !slices.Contains(tolerationOperators, tol.Operator) {
+			add(field+".operator", fmt.Sprintf("unknown operator %q", tol.Operator))
+		}
+		if tol.Operator == task.TolerationExists && tol.Value != "" {
+			add(field+".value", "must be empty with operator Exists")
+		}
+		if tol.Operator != task.TolerationExists && tol.Key == "" {
+			add(field+".key", "is required unless operator is Exists")
+		}
+		if !slices.Contains(taintEffects, tol.Effect) {
+			add(field+".effect", fmt.Sprintf("unknown effect %q", tol.Effect))
+		}
+	}
+	for _, e := range t.Env {
+		if k, _, _ := strings.Cut(e, "="); k == "" {
+			add("env", fmt.Sprintf("invalid entry %q", e))
+		}
+	}
+	return errs
+}
+
+func validateAffinityTerms(terms *task.AffinityTerms, field string) []FieldError {
+	if terms == nil {
+		return nil
+	}
+
+	var errs []FieldError
+	for i, s := range terms.Required {
+		if _, err := task.ParseSelector(s); err != nil {
+			errs = append(errs, FieldError{fmt.Sprintf("%s.required[%d]", field, i), err.Error()})
+		}
+	}
+	for i, p := range terms.Preferred {
+		if _, err := task.ParseSelector(p.Selector); err != nil {
+			errs = append(errs, FieldError{fmt.Sprintf("%s.preferred[%d].selector", field, i), err.Error()})
+		}
+		if p.Weight < 1 || p.Weight > 100 {
+			errs = append(errs, FieldError{fmt.Sprintf("%s.preferred[%d].weight", field, i), "must be between 1 and 100"})
+		}
+	}
+	return errs
+}
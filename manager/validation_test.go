@@ -0,0 +1,168 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+func TestValidateTaskEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*task.TaskEvent)
+		want   []FieldError
+	}{
+		{name: "valid", modify: func(te *task.TaskEvent) {}},
+		{
+			name:   "event not pending",
+			modify: func(te *task.TaskEvent) { te.State = task.Running },
+			want:   []FieldError{{"state", "must be Pending, got Running"}},
+		},
+		{
+			name: "runtime fields set",
+			modify: func(te *task.TaskEvent) {
+				te.Task.State = task.Completed
+				te.Task.ContainerID = "c1"
+			},
+			want: []FieldError{
+				{"task.state", "must be Pending, got Completed"},
+				{"task.containerId", "must not be set on submission"},
+			},
+		},
+		{
+			name: "missing id and image",
+			modify: func(te *task.TaskEvent) {
+				te.Task.ID = uuid.Nil
+				te.Task.Image = ""
+			},
+			want: []FieldError{{"task.id", "is required"}, {"task.image", "is required"}},
+		},
+		{
+			name:   "bad namespace",
+			modify: func(te *task.TaskEvent) { te.Task.Namespace = "Team_A" },
+			want:   []FieldError{{"task.namespace", `invalid namespace "Team_A", expected a lowercase DNS label`}},
+		},
+		{
+			name: "unknown policies",
+			modify: func(te *task.TaskEvent) {
+				te.Task.ImagePullPolicy = "Sometimes"
+				te.Task.RestartPolicy = "never"
+				te.Task.PreemptionPolicy = "Ignore"
+			},
+			want: []FieldError{
+				{"task.imagePullPolicy", `unknown pull policy "Sometimes"`},
+				{"task.restartPolicy", `unknown restart policy "never"`},
+				{"task.preemptionPolicy", `unknown preemption policy "Ignore"`},
+			},
+		},
+		{
+			name: "resources",
+			modify: func(te *task.TaskEvent) {
+				te.Task.CpuRequest = 2
+				te.Task.CpuLimit = 1
+				te.Task.Memory = -1
+				te.Task.Disk = -1
+			},
+			want: []FieldError{
+				{"task.cpuRequest", "must not exceed cpuLimit"},
+				{"task.memory", "must not be negative"},
+				{"task.disk", "must not be negative"},
+			},
+		},
+		{
+			name: "tolerations",
+			modify: func(te *task.TaskEvent) {
+				te.Task.Tolerations = []task.Toleration{
+					{Operator: task.TolerationExists, Value: "gpu"},
+					{Operator: "In", Effect: "Evict"},
+				}
+			},
+			want: []FieldError{
+				{"task.tolerations[0].value", "must be empty with operator Exists"},
+				{"task.tolerations[1].operator", `unknown operator "In"`},
+				{"task.tolerations[1].key", "is required unless operator is Exists"},
+				{"task.tolerations[1].effect", `unknown effect "Evict"`},
+			},
+		},
+		{
+			name: "affinity weight",
+			modify: func(te *task.TaskEvent) {
+				te.Task.Affinity = &task.Affinity{Node: &task.AffinityTerms{
+					Preferred: []task.WeightedSelector{{Weight: 0, Selector: "zone=a"}},
+				}}
+			},
+			want: []FieldError{{"task.affinity.node.preferred[0].weight", "must be between 1 and 100"}},
+		},
+		{
+			name:   "env without key",
+			modify: func(te *task.TaskEvent) { te.Task.Env = []string{"A=1", "=2"} },
+			want:   []FieldError{{"task.env", `invalid entry "=2"`}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			te := testSubmission()
+			tt.modify(&te)
+
+			err := ValidateTaskEvent(te)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("ValidateTaskEvent() = %v, want nil", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) || !errors.Is(err, ErrInvalidTask) {
+				t.Fatalf("ValidateTaskEvent() = %v, want a ValidationError", err)
+			}
+			if len(verr.Errors) != len(tt.want) {
+				t.Fatalf("errors = %v, want %v", verr.Errors, tt.want)
+			}
+			for i, fe := range verr.Errors {
+				if fe != tt.want[i] {
+					t.Errorf("error %d = %v, want %v", i, fe, tt.want[i])
+				}
+				if !strings.Contains(err.Error(), fe.Field+": "+fe.Message) {
+					t.Errorf("Error() = %q, missing %q", err.Error(), fe.Field)
+				}
+			}
+		})
+	}
+}
+
+func TestStartTaskHandlerValidation(t *testing.T) {
+	a := newAuthTestApi(t, newTestManager(t))
+
+	te := testSubmission()
+	te.Task.Image = ""
+	te.Task.Memory = -1
+	body, _ := json.Marshal(te)
+
+	rec := httptest.NewRecorder()
+	a.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(string(body))))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+
+	var resp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding error response: %v", err)
+	}
+	want := []FieldError{{"task.image", "is required"}, {"task.memory", "must not be negative"}}
+	if len(resp.Errors) != len(want) {
+		t.Fatalf("errors = %v, want %v", resp.Errors, want)
+	}
+	for i := range want {
+		if resp.Errors[i] != want[i] {
+			t.Errorf("error %d = %v, want %v", i, resp.Errors[i], want[i])
+		}
+	}
+}
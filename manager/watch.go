@@ -0,0 +1,113 @@
+package manager
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/reversearrow/orchestrator/node"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+const (
+	WatchKindTask = "task"
+	WatchKindNode = "node"
+)
+
+const (
+	NodeReady       = "Ready"
+	NodeUnreachable = "Unreachable"
+	NodeUpdated     = "Updated"
+)
+
+var ErrRevisionCompacted = errors.New("requested revision is no longer available")
+
+type WatchEvent struct {
+	Revision   int64         `json:"revision"`
+	Kind       string        `json:"kind"`
+	Task       *task.Task    `json:"task,omitempty"`
+	Transition *HistoryEntry `json:"transition,omitempty"`
+	Node       *node.Node    `json:"node,omitempty"`
+	NodeStatus string        `json:"nodeStatus,omitempty"`
+	Timestamp  time.Time     `json:"timestamp"`
+}
+
+// Watcher fans out task and node changes to subscribers. Every event gets a
+// monotonically increasing revision, and the last Size events are retained
+// so that a reconnecting client can resume from the revision it last saw.
+type Watcher struct {
+	Size int
+
+	mu          sync.Mutex
+	revision    int64
+	events      []WatchEvent
+	subscribers map[chan WatchEvent]struct{}
+}
+
+func NewWatcher(size int) *Watcher {
+	return &Watcher{
+		Size:        size,
+		subscribers: make(map[chan WatchEvent]struct{}),
+	}
+}
+
+func (w *Watcher) Publish(e WatchEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.revision++
+	e.Revision = w.revision
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+
+	w.events = append(w.events, e)
+	if len(w.events) > w.Size {
+		w.events = w.events[len(w.events)-w.Size:]
+	}
+
+	for ch := range w.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// The subscriber is not keeping up; dropping it lets the client
+			// reconnect and resume from its last revision.
+			delete(w.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the retained events after revision and a channel that
+// receives every later event. A negative revision subscribes to new events
+// only.
+func (w *Watcher) Subscribe(revision int64) ([]WatchEvent, chan WatchEvent, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var backlog []WatchEvent
+	if revision >= 0 && revision < w.revision {
+		if len(w.events) == 0 || w.events[0].Revision > revision+1 {
+			return nil, nil, ErrRevisionCompacted
+		}
+		for _, e := range w.events {
+			if e.Revision > revision {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+
+	ch := make(chan WatchEvent, 64)
+	w.subscribers[ch] = struct{}{}
+	return backlog, ch, nil
+}
+
+func (w *Watcher) Unsubscribe(ch chan WatchEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.subscribers[ch]; ok {
+		delete(w.subscribers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,147 @@
+package manager
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/auth"
+	"github.com/reversearrow/orchestrator/node"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+func TestWatcherSubscribe(t *testing.T) {
+	tests := []struct {
+		name     string
+		revision int64
+		want     []int64
+		wantErr  error
+	}{
+		{name: "new events only", revision: -1},
+		{name: "up to date", revision: 5},
+		{name: "resume within window", revision: 3, want: []int64{4, 5}},
+		{name: "resume from oldest retained", revision: 2, want: []int64{3, 4, 5}},
+		{name: "compacted", revision: 1, wantErr: ErrRevisionCompacted},
+		{name: "from the beginning", revision: 0, wantErr: ErrRevisionCompacted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWatcher(3)
+			for i := 0; i < 5; i++ {
+				w.Publish(WatchEvent{Kind: WatchKindTask})
+			}
+
+			backlog, ch, err := w.Subscribe(tt.revision)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Subscribe(%d) error = %v, want %v", tt.revision, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer w.Unsubscribe(ch)
+
+			var got []int64
+			for _, e := range backlog {
+				got = append(got, e.Revision)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Subscribe(%d) backlog = %v, want %v", tt.revision, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Subscribe(%d) backlog = %v, want %v", tt.revision, got, tt.want)
+				}
+			}
+
+			w.Publish(WatchEvent{Kind: WatchKindNode})
+			if e := <-ch; e.Revision != 6 || e.Kind != WatchKindNode {
+				t.Errorf("received %+v, want revision 6 of kind %s", e, WatchKindNode)
+			}
+		})
+	}
+}
+
+func TestWatcherDropsSlowSubscriber(t *testing.T) {
+	w := NewWatcher(10)
+	_, ch, err := w.Subscribe(-1)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	for i := 0; i < cap(ch)+1; i++ {
+		w.Publish(WatchEvent{Kind: WatchKindTask})
+	}
+
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != cap(ch) {
+		t.Errorf("received %d events before the channel closed, want %d", n, cap(ch))
+	}
+
+	// Unsubscribing a dropped subscriber must not close the channel twice.
+	w.Unsubscribe(ch)
+}
+
+func TestWatchHandlerNamespace(t *testing.T) {
+	m := newTestManager(t)
+	a := newAuthTestApi(t, m, "alice")
+	a.Policy = &auth.Policy{
+		Roles:    auth.DefaultRoles(),
+		Bindings: []auth.Binding{{Role: "viewer", Users: []string{"alice"}, Namespaces: []string{"team-a"}}},
+	}
+
+	m.Watcher.Publish(WatchEvent{Kind: WatchKindTask, Task: &task.Task{ID: uuid.New(), Namespace: "team-a"}})
+	m.Watcher.Publish(WatchEvent{Kind: WatchKindTask, Task: &task.Task{ID: uuid.New(), Namespace: "team-b"}})
+	m.Watcher.Publish(WatchEvent{Kind: WatchKindNode, Node: &node.Node{Name: "w1:5555"}, NodeStatus: NodeReady})
+	m.Watcher.Publish(WatchEvent{Kind: WatchKindTask, Task: &task.Task{ID: uuid.New(), Namespace: "team-a"}})
+
+	tests := []struct {
+		name string
+		path string
+		want int
+		ids  []string
+	}{
+		{name: "namespaced route", path: "/namespaces/team-a/watch?revision=0", want: http.StatusOK, ids: []string{"1", "4"}},
+		{name: "namespaced route with kind", path: "/namespaces/team-a/watch?revision=0&kind=node", want: http.StatusOK},
+		{name: "other namespace", path: "/namespaces/team-b/watch?revision=0", want: http.StatusForbidden},
+		{name: "cluster watch", path: "/watch?revision=0", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// With the request already cancelled the handler returns right
+			// after writing the backlog.
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil).WithContext(ctx)
+			r.Header.Set("Authorization", "Bearer alice")
+			rec := httptest.NewRecorder()
+			a.Router.ServeHTTP(rec, r)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var ids []string
+			sc := bufio.NewScanner(rec.Body)
+			for sc.Scan() {
+				if id, ok := strings.CutPrefix(sc.Text(), "id: "); ok {
+					ids = append(ids, id)
+				}
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.ids, ",") {
+				t.Errorf("streamed revisions %v, want %v", ids, tt.ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+const (
+	FailurePolicyFail   = "Fail"
+	FailurePolicyIgnore = "Ignore"
+
+	defaultWebhookTimeout = 5 * time.Second
+	maxWebhookResponse    = 1 << 20
+)
+
+type WebhookConfig struct {
+	Name          string
+	URL           string
+	Timeout       string
+	FailurePolicy string
+}
+
+func LoadWebhookConfigs(path string) ([]WebhookConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading admission webhooks: %w", err)
+	}
+
+	var configs []WebhookConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("error decoding admission webhooks: %w", err)
+	}
+	return configs, nil
+}
+
+// AdmissionReview is the body posted to an admission webhook.
+type AdmissionReview struct {
+	APIVersion string         `json:"apiVersion"`
+	UID        uuid.UUID      `json:"uid"`
+	Event      task.TaskEvent `json:"event"`
+}
+
+// AdmissionResponse is the answer expected from an admission webhook. A
+// webhook that allows the event may also return a JSON merge patch (RFC 7386)
+// to apply to it.
+type AdmissionResponse struct {
+	UID     uuid.UUID       `json:"uid"`
+	Allowed bool            `json:"allowed"`
+	Reason  string          `json:"reason,omitempty"`
+	Patch   json.RawMessage `json:"patch,omitempty"`
+}
+
+// Webhook is an AdmissionController backed by an external HTTP service.
+type Webhook struct {
+	name          string
+	url           string
+	timeout       time.Duration
+	failurePolicy string
+	client        *http.Client
+	logger        *log.Logger
+}
+
+func NewWebhook(l *log.Logger, c *http.Client, cfg WebhookConfig) (*Webhook, error) {
+	wh := &Webhook{
+		name:          cfg.Name,
+		url:           cfg.URL,
+		timeout:       defaultWebhookTimeout,
+		failurePolicy: cfg.FailurePolicy,
+		client:        c,
+		logger:        l,
+	}
+	if wh.failurePolicy == "" {
+		wh.failurePolicy = FailurePolicyFail
+	}
+	if cfg.Timeout != "" {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout for webhook %q: %w", cfg.Name, err)
+		}
+		wh.timeout = d
+	}
+
+	if err := wh.validate(); err != nil {
+		return nil, err
+	}
+	return wh, nil
+}
+
+func (wh *Webhook) validate() error {
+	if wh.name == "" {
+		return fmt.Errorf("webhook name is empty")
+	}
+	if wh.url == "" {
+		return fmt.Errorf("webhook %q has no url", wh.name)
+	}
+	if wh.timeout <= 0 {
+		return fmt.Errorf("webhook %q timeout must be positive", wh.name)
+	}
+	if wh.failurePolicy != FailurePolicyFail && wh.failurePolicy != FailurePolicyIgnore {
+		return fmt.Errorf("webhook %q has unknown failure policy %q", wh.name, wh.failurePolicy)
+	}
+	if wh.client == nil {
+		return fmt.Errorf("http client is nil")
+	}
+	if wh.logger == nil {
+		return fmt.Errorf("logger is nil")
+	}
+	return nil
+}
+
+func (wh *Webhook) Name() string {
+	return "webhook " + wh.name
+}
+
+func (wh *Webhook) Admit(te *task.TaskEvent) error {
+	resp, err := wh.call(*te)
+	if err != nil {
+		if wh.failurePolicy == FailurePolicyIgnore {
+			wh.logger.Printf("webhook %s: allowed task %v, call failed and failure policy is %s: %v\n", wh.name, te.Task.ID, wh.failurePolicy, err)
+			return nil
+		}
+		wh.logger.Printf("webhook %s: denied task %v, call failed: %v\n", wh.name, te.Task.ID, err)
+		return &AdmissionError{Controller: wh.Name(), Reason: fmt.Sprintf("webhook call failed: %v", err)}
+	}
+
+	if !resp.Allowed {
+		wh.logger.Printf("webhook %s: denied task %v: %s\n", wh.name, te.Task.ID, resp.Reason)
+		return &AdmissionError{Controller: wh.Name(), Reason: resp.Reason}
+	}
+
+	if len(resp.Patch) == 0 || string(resp.Patch) == "null" {
+		wh.logger.Printf("webhook %s: allowed task %v\n", wh.name, te.Task.ID)
+		return nil
+	}
+
+	patched, err := applyMergePatch(*te, resp.Patch)
+	if err != nil {
+		wh.logger.Printf("webhook %s: denied task %v, invalid patch: %v\n", wh.name, te.Task.ID, err)
+		return &AdmissionError{Controller: wh.Name(), Reason: fmt.Sprintf("invalid patch: %v", err)}
+	}
+	wh.logger.Printf("webhook %s: allowed task %v with patch %s\n", wh.name, te.Task.ID, resp.Patch)
+	*te = patched
+	return nil
+}
+
+func (wh *Webhook) call(te task.TaskEvent) (*AdmissionResponse, error) {
+	review := AdmissionReview{
+		APIVersion: task.APIVersion,
+		UID:        uuid.New(),
+		Event:      te,
+	}
+	data, err := json.Marshal(review)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), wh.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var ar AdmissionResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxWebhookResponse)).Decode(&ar); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if ar.UID != review.UID {
+		return nil, fmt.Errorf("response uid %v does not match request uid %v", ar.UID, review.UID)
+	}
+	return &ar, nil
+}
+
+// applyMergePatch applies an RFC 7386 JSON merge patch to te. The result is
+// decoded strictly, so a patch cannot introduce unknown fields or change the
+// API version.
+func applyMergePatch(te task.TaskEvent, patch json.RawMessage) (task.TaskEvent, error) {
+	data, err := json.Marshal(te)
+	if err != nil {
+		return te, err
+	}
+
+	var doc, p interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return te, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return te, err
+	}
+
+	merged, err := json.Marshal(mergePatch(doc, p))
+	if err != nil {
+		return te, err
+	}
+	return task.DecodeTaskEvent(bytes.NewReader(merged))
+}
+
+func mergePatch(doc, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	d, ok := doc.(map[string]interface{})
+	if !ok {
+		d = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(d, k)
+			continue
+		}
+		d[k] = mergePatch(d[k], v)
+	}
+	return d
+}
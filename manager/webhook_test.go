@@ -0,0 +1,195 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+// webhookStub answers admission reviews with resp, echoing the review's uid.
+func webhookStub(t *testing.T, resp AdmissionResponse) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var review AdmissionReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp.UID = review.UID
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testSubmission() task.TaskEvent {
+	return task.TaskEvent{
+		ID:    uuid.New(),
+		State: task.Pending,
+		Task: task.Task{
+			ID:        uuid.New(),
+			Namespace: "team-a",
+			State:     task.Pending,
+			Image:     "nginx:1.25",
+			Labels:    map[string]string{"app": "web", "tier": "front"},
+		},
+	}
+}
+
+func TestWebhookAdmit(t *testing.T) {
+	tests := []struct {
+		name     string
+		resp     AdmissionResponse
+		wantErr  bool
+		wantTask func(task.Task) bool
+	}{
+		{
+			name:     "allowed",
+			resp:     AdmissionResponse{Allowed: true},
+			wantTask: func(tk task.Task) bool { return tk.Image == "nginx:1.25" },
+		},
+		{
+			name:    "denied",
+			resp:    AdmissionResponse{Allowed: false, Reason: "images must come from the internal registry"},
+			wantErr: true,
+		},
+		{
+			name: "merge patch",
+			resp: AdmissionResponse{Allowed: true, Patch: json.RawMessage(
+				`{"task": {"memory": 256, "labels": {"team": "a", "tier": null}}}`)},
+			wantTask: func(tk task.Task) bool {
+				return tk.Memory == 256 && tk.Image == "nginx:1.25" &&
+					tk.Labels["app"] == "web" && tk.Labels["team"] == "a" && tk.Labels["tier"] == ""
+			},
+		},
+		{
+			name:    "patch with an unknown field",
+			resp:    AdmissionResponse{Allowed: true, Patch: json.RawMessage(`{"task": {"privileged": true}}`)},
+			wantErr: true,
+		},
+		{
+			name:    "patch changing the api version",
+			resp:    AdmissionResponse{Allowed: true, Patch: json.RawMessage(`{"apiVersion": "cube/v2"}`)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := webhookStub(t, tt.resp)
+			wh, err := NewWebhook(log.New(io.Discard, "", 0), srv.Client(), WebhookConfig{Name: "policy", URL: srv.URL})
+			if err != nil {
+				t.Fatalf("NewWebhook: %v", err)
+			}
+
+			te := testSubmission()
+			err = wh.Admit(&te)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Admit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrAdmissionDenied) {
+					t.Errorf("Admit() error = %v, want %v", err, ErrAdmissionDenied)
+				}
+				return
+			}
+			if !tt.wantTask(te.Task) {
+				t.Errorf("admitted task %+v", te.Task)
+			}
+		})
+	}
+}
+
+func TestWebhookFailurePolicy(t *testing.T) {
+	failing := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"error status", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}},
+		{"invalid body", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("not json"))
+		}},
+		{"uid mismatch", func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(AdmissionResponse{UID: uuid.New(), Allowed: true})
+		}},
+		{"timeout", func(w http.ResponseWriter, r *http.Request) {
+			// The server only notices the client giving up once the body
+			// has been read.
+			io.Copy(io.Discard, r.Body)
+			<-r.Context().Done()
+		}},
+	}
+
+	for _, f := range failing {
+		for _, policy := range []string{FailurePolicyFail, FailurePolicyIgnore} {
+			t.Run(f.name+"/"+policy, func(t *testing.T) {
+				srv := httptest.NewServer(f.handler)
+				defer srv.Close()
+
+				wh, err := NewWebhook(log.New(io.Discard, "", 0), srv.Client(), WebhookConfig{
+					Name: "policy", URL: srv.URL, Timeout: "50ms", FailurePolicy: policy,
+				})
+				if err != nil {
+					t.Fatalf("NewWebhook: %v", err)
+				}
+
+				te := testSubmission()
+				start := time.Now()
+				err = wh.Admit(&te)
+				if policy == FailurePolicyFail && !errors.Is(err, ErrAdmissionDenied) {
+					t.Errorf("Admit() error = %v, want %v", err, ErrAdmissionDenied)
+				}
+				if policy == FailurePolicyIgnore && err != nil {
+					t.Errorf("Admit() error = %v, want nil", err)
+				}
+				if d := time.Since(start); d > 2*time.Second {
+					t.Errorf("Admit() took %v, the timeout was not applied", d)
+				}
+			})
+		}
+	}
+}
+
+func TestAdmitIdentity(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		wantErr bool
+	}{
+		{name: "spec change", patch: `{"task": {"memory": 128}}`},
+		{name: "namespace change", patch: `{"task": {"namespace": "team-b"}}`, wantErr: true},
+		{name: "task id change", patch: `{"task": {"id": "` + uuid.NewString() + `"}}`, wantErr: true},
+		{name: "event id change", patch: `{"id": "` + uuid.NewString() + `"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := webhookStub(t, AdmissionResponse{Allowed: true, Patch: json.RawMessage(tt.patch)})
+			wh, err := NewWebhook(log.New(io.Discard, "", 0), srv.Client(), WebhookConfig{Name: "policy", URL: srv.URL})
+			if err != nil {
+				t.Fatalf("NewWebhook: %v", err)
+			}
+			m := newTestManager(t)
+			m.Admission = append(m.Admission, wh)
+
+			te := testSubmission()
+			err = m.Admit(&te)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Admit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrAdmissionDenied) {
+				t.Errorf("Admit() error = %v, want %v", err, ErrAdmissionDenied)
+			}
+		})
+	}
+}
@@ -1,13 +1,151 @@
 package node
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+// Taint effects. Tasks that do not tolerate a NoSchedule taint are not placed
+// on the node, PreferNoSchedule only makes the node less attractive, and
+// NoExecute also evicts the tasks already on it.
+const (
+	TaintNoSchedule       = "NoSchedule"
+	TaintPreferNoSchedule = "PreferNoSchedule"
+	TaintNoExecute        = "NoExecute"
+)
+
 type Node struct {
 	Name            string
 	IP              string
 	Cores           int
+	CpuAllocated    float64
 	Memory          int
 	MemoryAllocated int
 	Disk            int
 	DiskAllocated   int
 	Role            string
 	TaskCount       int
+	Images          []string
+	Labels          map[string]string
+	Taints          []Taint
+	// Placements lists the tasks assigned to the node when the scheduler
+	// evaluates it, for anti-affinity rules.
+	Placements []Placement `json:"-"`
+}
+
+type Taint struct {
+	Key    string
+	Value  string
+	Effect string
+}
+
+func (t Taint) String() string {
+	if t.Value == "" {
+		return fmt.Sprintf("%s:%s", t.Key, t.Effect)
+	}
+	return fmt.Sprintf("%s=%s:%s", t.Key, t.Value, t.Effect)
+}
+
+type Placement struct {
+	Namespace string
+	Labels    map[string]string
+}
+
+func NewNode(name string, role string) *Node {
+	return &Node{
+		Name: name,
+		Role: role,
+	}
+}
+
+func (n *Node) CpuAvailable() float64 {
+	return float64(n.Cores) - n.CpuAllocated
+}
+
+func (n *Node) DiskAvailable() int {
+	return n.Disk - n.DiskAllocated
+}
+
+func (n *Node) HasImage(image string) bool {
+	want := normalizeImage(image)
+	for _, i := range n.Images {
+		if normalizeImage(i) == want {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeImage(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	return reference.TagNameOnly(named).String()
+}
+
+// ParseLabels reads labels in the form "zone=us-east-1a,gpu=true".
+func ParseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", part)
+		}
+		labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return labels, ValidateLabels(labels)
+}
+
+// ValidateLabels rejects labels that could not be matched by a selector.
+func ValidateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if k == "" || strings.ContainsAny(k, ",=! ") {
+			return fmt.Errorf("invalid label key %q", k)
+		}
+		if strings.Contains(v, ",") {
+			return fmt.Errorf("invalid value %q for label %q", v, k)
+		}
+	}
+	return nil
+}
+
+// ParseTaints reads taints in the form "dedicated=gpu:NoSchedule,maintenance:NoExecute".
+func ParseTaints(s string) ([]Taint, error) {
+	var taints []Taint
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		kv, effect, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid taint %q, expected key[=value]:effect", part)
+		}
+		key, value, _ := strings.Cut(kv, "=")
+		taints = append(taints, Taint{Key: key, Value: value, Effect: effect})
+	}
+	return taints, ValidateTaints(taints)
+}
+
+func ValidateTaints(taints []Taint) error {
+	for _, t := range taints {
+		if t.Key == "" || strings.ContainsAny(t.Key, ",=:! ") {
+			return fmt.Errorf("invalid taint key %q", t.Key)
+		}
+		switch t.Effect {
+		case TaintNoSchedule, TaintPreferNoSchedule, TaintNoExecute:
+		default:
+			return fmt.Errorf("unknown effect %q for taint %q", t.Effect, t.Key)
+		}
+	}
+	return nil
 }
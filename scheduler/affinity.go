@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"github.com/reversearrow/orchestrator/node"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+// preferencePenalty is added to the score of a node in proportion to the
+// weight of the task's preferred affinity rules it does not satisfy. It
+// outweighs the image penalty: placement preferences come before cache hits.
+const preferencePenalty = 2.0
+
+func checkNodeSelector(t task.Task, n *node.Node) bool {
+	for k, v := range t.NodeSelector {
+		if value, ok := n.Labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+func checkNodeAffinity(t task.Task, n *node.Node) bool {
+	if t.Affinity == nil || t.Affinity.Node == nil || len(t.Affinity.Node.Required) == 0 {
+		return true
+	}
+	for _, s := range t.Affinity.Node.Required {
+		if sel, err := task.ParseSelector(s); err == nil && sel.Matches(n.Labels) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkTaskAntiAffinity(t task.Task, n *node.Node) bool {
+	if t.Affinity == nil || t.Affinity.TaskAnti == nil {
+		return true
+	}
+	for _, s := range t.Affinity.TaskAnti.Required {
+		sel, err := task.ParseSelector(s)
+		if err != nil || placedMatching(t, n, sel) {
+			return false
+		}
+	}
+	return true
+}
+
+// placedMatching reports whether a task in t's namespace on n matches sel.
+func placedMatching(t task.Task, n *node.Node, sel task.Selector) bool {
+	for _, p := range n.Placements {
+		if p.Namespace == t.Namespace && sel.Matches(p.Labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// preferenceMiss returns the share, between 0 and 1, of the weight of t's
+// preferred affinity rules that n does not satisfy.
+func preferenceMiss(t task.Task, n *node.Node) float64 {
+	if t.Affinity == nil {
+		return 0
+	}
+
+	var total, missed int
+	if t.Affinity.Node != nil {
+		for _, p := range t.Affinity.Node.Preferred {
+			sel, err := task.ParseSelector(p.Selector)
+			if err != nil {
+				continue
+			}
+			total += p.Weight
+			if !sel.Matches(n.Labels) {
+				missed += p.Weight
+			}
+		}
+	}
+	if t.Affinity.TaskAnti != nil {
+		for _, p := range t.Affinity.TaskAnti.Preferred {
+			sel, err := task.ParseSelector(p.Selector)
+			if err != nil {
+				continue
+			}
+			total += p.Weight
+			if placedMatching(t, n, sel) {
+				missed += p.Weight
+			}
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return float64(missed) / float64(total)
+}
@@ -0,0 +1,136 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/reversearrow/orchestrator/node"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+func labelledNode() *node.Node {
+	n := node.NewNode("w1", "worker")
+	n.Labels = map[string]string{"zone": "a", "gpu": "true"}
+	n.Placements = []node.Placement{
+		{Namespace: "team-a", Labels: map[string]string{"app": "web"}},
+		{Namespace: "team-b", Labels: map[string]string{"app": "db"}},
+	}
+	return n
+}
+
+func TestCheckAffinity(t *testing.T) {
+	tests := []struct {
+		name string
+		task task.Task
+		want bool
+	}{
+		{name: "no constraints", task: task.Task{}, want: true},
+		{
+			name: "node selector matches",
+			task: task.Task{NodeSelector: map[string]string{"zone": "a", "gpu": "true"}},
+			want: true,
+		},
+		{
+			name: "node selector value differs",
+			task: task.Task{NodeSelector: map[string]string{"zone": "b"}},
+		},
+		{
+			name: "node selector label missing",
+			task: task.Task{NodeSelector: map[string]string{"ssd": "true"}},
+		},
+		{
+			name: "one required node selector matches",
+			task: task.Task{Affinity: &task.Affinity{Node: &task.AffinityTerms{
+				Required: []string{"zone=b", "zone=a,gpu"},
+			}}},
+			want: true,
+		},
+		{
+			name: "no required node selector matches",
+			task: task.Task{Affinity: &task.Affinity{Node: &task.AffinityTerms{
+				Required: []string{"zone=b", "!gpu"},
+			}}},
+		},
+		{
+			name: "preferred node terms do not filter",
+			task: task.Task{Affinity: &task.Affinity{Node: &task.AffinityTerms{
+				Preferred: []task.WeightedSelector{{Weight: 1, Selector: "zone=b"}},
+			}}},
+			want: true,
+		},
+		{
+			name: "anti-affinity with a task in the namespace",
+			task: task.Task{Namespace: "team-a", Affinity: &task.Affinity{TaskAnti: &task.AffinityTerms{
+				Required: []string{"app=web"},
+			}}},
+		},
+		{
+			name: "anti-affinity ignores other namespaces",
+			task: task.Task{Namespace: "team-a", Affinity: &task.Affinity{TaskAnti: &task.AffinityTerms{
+				Required: []string{"app=db"},
+			}}},
+			want: true,
+		},
+		{
+			name: "invalid anti-affinity selector",
+			task: task.Task{Namespace: "team-a", Affinity: &task.Affinity{TaskAnti: &task.AffinityTerms{
+				Required: []string{"=web"},
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := labelledNode()
+			got := checkNodeSelector(tt.task, n) && checkNodeAffinity(tt.task, n) && checkTaskAntiAffinity(tt.task, n)
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreferenceMiss(t *testing.T) {
+	tests := []struct {
+		name     string
+		affinity *task.Affinity
+		want     float64
+	}{
+		{name: "no affinity", want: 0},
+		{
+			name: "all preferences met",
+			affinity: &task.Affinity{Node: &task.AffinityTerms{
+				Preferred: []task.WeightedSelector{{Weight: 3, Selector: "zone=a"}},
+			}},
+			want: 0,
+		},
+		{
+			name: "missed share of the weight",
+			affinity: &task.Affinity{
+				Node: &task.AffinityTerms{Preferred: []task.WeightedSelector{
+					{Weight: 1, Selector: "zone=b"},
+					{Weight: 2, Selector: "gpu"},
+				}},
+				TaskAnti: &task.AffinityTerms{Preferred: []task.WeightedSelector{
+					{Weight: 1, Selector: "app=web"},
+				}},
+			},
+			want: 0.5,
+		},
+		{
+			name: "invalid selectors are ignored",
+			affinity: &task.Affinity{Node: &task.AffinityTerms{
+				Preferred: []task.WeightedSelector{{Weight: 5, Selector: "!"}, {Weight: 1, Selector: "zone=b"}},
+			}},
+			want: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tk := task.Task{Namespace: "team-a", Affinity: tt.affinity}
+			if got := preferenceMiss(tk, labelledNode()); got != tt.want {
+				t.Errorf("preferenceMiss() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
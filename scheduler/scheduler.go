@@ -1,7 +1,81 @@
 package scheduler
 
+import (
+	"github.com/reversearrow/orchestrator/node"
+	"github.com/reversearrow/orchestrator/task"
+)
+
 type Scheduler interface {
-	SelectCandidateNodes()
-	Score()
-	Pick()
+	SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node
+	Score(t task.Task, nodes []*node.Node) map[string]float64
+	Pick(scores map[string]float64, candidates []*node.Node) *node.Node
+}
+
+// imageMissingPenalty is added to the score of nodes that would have to pull
+// the task's image, so nodes with the image cached are preferred.
+const imageMissingPenalty = 1.0
+
+type RoundRobin struct {
+	Name       string
+	LastWorker int
+}
+
+func (r *RoundRobin) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
+	var candidates []*node.Node
+	for _, n := range nodes {
+		if checkCpu(t, n) && checkDisk(t, n) && checkNodeSelector(t, n) &&
+			checkNodeAffinity(t, n) && checkTaskAntiAffinity(t, n) && checkTaints(t, n) {
+			candidates = append(candidates, n)
+		}
+	}
+
+	return candidates
+}
+
+func (r *RoundRobin) Score(t task.Task, nodes []*node.Node) map[string]float64 {
+	scores := make(map[string]float64)
+	if len(nodes) == 0 {
+		return scores
+	}
+
+	r.LastWorker = (r.LastWorker + 1) % len(nodes)
+	for i, n := range nodes {
+		score := 1.0
+		if i == r.LastWorker {
+			score = 0.1
+		}
+		if !n.HasImage(t.Image) {
+			score += imageMissingPenalty
+		}
+		score += preferenceMiss(t, n) * preferencePenalty
+		score += float64(untoleratedPreferences(t, n)) * preferNoSchedulePenalty
+		scores[n.Name] = score
+	}
+
+	return scores
+}
+
+func (r *RoundRobin) Pick(scores map[string]float64, candidates []*node.Node) *node.Node {
+	var best *node.Node
+	var lowest float64
+	for _, n := range candidates {
+		score, ok := scores[n.Name]
+		if !ok {
+			continue
+		}
+		if best == nil || score < lowest {
+			best = n
+			lowest = score
+		}
+	}
+
+	return best
+}
+
+func checkCpu(t task.Task, n *node.Node) bool {
+	return t.CpuRequested() <= n.CpuAvailable()
+}
+
+func checkDisk(t task.Task, n *node.Node) bool {
+	return t.Disk <= n.DiskAvailable()
 }
@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"github.com/reversearrow/orchestrator/node"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+// preferNoSchedulePenalty is added to the score of a node for every
+// PreferNoSchedule taint the task does not tolerate. It outweighs the other
+// penalties so that such nodes are only used when nothing else fits.
+const preferNoSchedulePenalty = 4.0
+
+// Tolerates reports whether one of t's tolerations matches taint.
+func Tolerates(t task.Task, taint node.Taint) bool {
+	for _, tol := range t.Tolerations {
+		if tol.Effect != "" && tol.Effect != taint.Effect {
+			continue
+		}
+		if tol.Operator == task.TolerationExists {
+			if tol.Key == "" || tol.Key == taint.Key {
+				return true
+			}
+			continue
+		}
+		if tol.Key == taint.Key && tol.Value == taint.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func checkTaints(t task.Task, n *node.Node) bool {
+	for _, taint := range n.Taints {
+		if taint.Effect != node.TaintPreferNoSchedule && !Tolerates(t, taint) {
+			return false
+		}
+	}
+	return true
+}
+
+func untoleratedPreferences(t task.Task, n *node.Node) int {
+	var count int
+	for _, taint := range n.Taints {
+		if taint.Effect == node.TaintPreferNoSchedule && !Tolerates(t, taint) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,118 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/reversearrow/orchestrator/node"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+func TestTolerates(t *testing.T) {
+	gpu := node.Taint{Key: "dedicated", Value: "gpu", Effect: node.TaintNoSchedule}
+
+	tests := []struct {
+		name        string
+		tolerations []task.Toleration
+		want        bool
+	}{
+		{name: "no tolerations"},
+		{
+			name:        "equal key and value",
+			tolerations: []task.Toleration{{Key: "dedicated", Value: "gpu"}},
+			want:        true,
+		},
+		{
+			name:        "explicit equal operator",
+			tolerations: []task.Toleration{{Key: "dedicated", Operator: task.TolerationEqual, Value: "gpu", Effect: node.TaintNoSchedule}},
+			want:        true,
+		},
+		{
+			name:        "equal with a different value",
+			tolerations: []task.Toleration{{Key: "dedicated", Value: "db"}},
+		},
+		{
+			name:        "exists matches any value",
+			tolerations: []task.Toleration{{Key: "dedicated", Operator: task.TolerationExists}},
+			want:        true,
+		},
+		{
+			name:        "exists with a different key",
+			tolerations: []task.Toleration{{Key: "maintenance", Operator: task.TolerationExists}},
+		},
+		{
+			name:        "exists with an empty key matches every taint",
+			tolerations: []task.Toleration{{Operator: task.TolerationExists}},
+			want:        true,
+		},
+		{
+			name:        "effect must match",
+			tolerations: []task.Toleration{{Key: "dedicated", Value: "gpu", Effect: node.TaintNoExecute}},
+		},
+		{
+			name: "any toleration may match",
+			tolerations: []task.Toleration{
+				{Key: "maintenance", Operator: task.TolerationExists},
+				{Key: "dedicated", Value: "gpu", Effect: node.TaintNoSchedule},
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Tolerates(task.Task{Tolerations: tt.tolerations}, gpu); got != tt.want {
+				t.Errorf("Tolerates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTaints(t *testing.T) {
+	n := node.NewNode("w1", "worker")
+	n.Taints = []node.Taint{
+		{Key: "dedicated", Value: "gpu", Effect: node.TaintNoSchedule},
+		{Key: "spot", Effect: node.TaintPreferNoSchedule},
+		{Key: "old-kernel", Effect: node.TaintPreferNoSchedule},
+	}
+
+	tests := []struct {
+		name        string
+		tolerations []task.Toleration
+		want        bool
+		preferences int
+	}{
+		{name: "untolerated NoSchedule", preferences: 2},
+		{
+			name:        "PreferNoSchedule only scores",
+			tolerations: []task.Toleration{{Key: "dedicated", Value: "gpu"}},
+			want:        true,
+			preferences: 2,
+		},
+		{
+			name: "tolerated preference",
+			tolerations: []task.Toleration{
+				{Key: "dedicated", Value: "gpu"},
+				{Key: "spot", Operator: task.TolerationExists, Effect: node.TaintPreferNoSchedule},
+			},
+			want:        true,
+			preferences: 1,
+		},
+		{
+			name:        "tolerates everything",
+			tolerations: []task.Toleration{{Operator: task.TolerationExists}},
+			want:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tk := task.Task{Tolerations: tt.tolerations}
+			if got := checkTaints(tk, n); got != tt.want {
+				t.Errorf("checkTaints() = %v, want %v", got, tt.want)
+			}
+			if got := untoleratedPreferences(tk, n); got != tt.preferences {
+				t.Errorf("untoleratedPreferences() = %d, want %d", got, tt.preferences)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package task
+
+const (
+	TolerationEqual  = "Equal"
+	TolerationExists = "Exists"
+)
+
+// Affinity constrains where a task is scheduled. Node terms are matched
+// against node labels and task anti-affinity terms against the labels of
+// tasks in the same namespace already on a node. Selectors use the syntax of
+// ParseSelector.
+type Affinity struct {
+	Node     *AffinityTerms `json:"node,omitempty"`
+	TaskAnti *AffinityTerms `json:"taskAnti,omitempty"`
+}
+
+// AffinityTerms holds hard and soft rules. For node affinity a node must
+// match one of the required selectors; for anti-affinity no task on the node
+// may match any of them. Preferred selectors only change the score.
+type AffinityTerms struct {
+	Required  []string           `json:"required,omitempty"`
+	Preferred []WeightedSelector `json:"preferred,omitempty"`
+}
+
+type WeightedSelector struct {
+	Weight   int    `json:"weight"`
+	Selector string `json:"selector"`
+}
+
+// Toleration lets a task run on nodes with matching taints. An empty operator
+// means Equal; Exists matches any value, and every key when Key is empty. An
+// empty effect matches every effect.
+type Toleration struct {
+	Key      string `json:"key,omitempty"`
+	Operator string `json:"operator,omitempty"`
+	Value    string `json:"value,omitempty"`
+	Effect   string `json:"effect,omitempty"`
+}
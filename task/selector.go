@@ -0,0 +1,85 @@
+package task
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	SelectorEquals       = "="
+	SelectorNotEquals    = "!="
+	SelectorExists       = "exists"
+	SelectorDoesNotExist = "!exists"
+)
+
+type Requirement struct {
+	Key      string
+	Operator string
+	Value    string
+}
+
+// Selector matches labels against every one of its requirements.
+type Selector []Requirement
+
+// ParseSelector parses a comma separated list of requirements of the form
+// key=value, key!=value, key (the label is set) and !key (it is not).
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var r Requirement
+		switch {
+		case strings.Contains(part, "!="):
+			key, value, _ := strings.Cut(part, "!=")
+			r = Requirement{Key: key, Operator: SelectorNotEquals, Value: value}
+		case strings.Contains(part, "="):
+			key, value, _ := strings.Cut(part, "=")
+			r = Requirement{Key: key, Operator: SelectorEquals, Value: value}
+		case strings.HasPrefix(part, "!"):
+			r = Requirement{Key: strings.TrimPrefix(part, "!"), Operator: SelectorDoesNotExist}
+		default:
+			r = Requirement{Key: part, Operator: SelectorExists}
+		}
+
+		r.Key = strings.TrimSpace(r.Key)
+		r.Value = strings.TrimSpace(r.Value)
+		if r.Key == "" {
+			return nil, fmt.Errorf("invalid selector requirement %q", part)
+		}
+		sel = append(sel, r)
+	}
+
+	if len(sel) == 0 {
+		return nil, fmt.Errorf("empty selector")
+	}
+	return sel, nil
+}
+
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		value, ok := labels[r.Key]
+		switch r.Operator {
+		case SelectorEquals:
+			if !ok || value != r.Value {
+				return false
+			}
+		case SelectorNotEquals:
+			if ok && value == r.Value {
+				return false
+			}
+		case SelectorExists:
+			if !ok {
+				return false
+			}
+		case SelectorDoesNotExist:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
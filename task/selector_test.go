@@ -0,0 +1,69 @@
+package task
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Selector
+		wantErr bool
+	}{
+		{in: "app=web", want: Selector{{Key: "app", Operator: SelectorEquals, Value: "web"}}},
+		{in: "app != web", want: Selector{{Key: "app", Operator: SelectorNotEquals, Value: "web"}}},
+		{in: "gpu", want: Selector{{Key: "gpu", Operator: SelectorExists}}},
+		{in: "!gpu", want: Selector{{Key: "gpu", Operator: SelectorDoesNotExist}}},
+		{in: "app=web,tier=", want: Selector{
+			{Key: "app", Operator: SelectorEquals, Value: "web"},
+			{Key: "tier", Operator: SelectorEquals, Value: ""},
+		}},
+		{in: "app=web,,", want: Selector{{Key: "app", Operator: SelectorEquals, Value: "web"}}},
+		{in: "", wantErr: true},
+		{in: " , ", wantErr: true},
+		{in: "=web", wantErr: true},
+		{in: "!", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSelector(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSelector(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSelector(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	labels := map[string]string{"app": "web", "tier": "frontend"}
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"app=web", true},
+		{"app=api", false},
+		{"app!=api", true},
+		{"app!=web", false},
+		{"zone!=us", true},
+		{"tier", true},
+		{"zone", false},
+		{"!zone", true},
+		{"!tier", false},
+		{"app=web,tier=frontend", true},
+		{"app=web,tier=backend", false},
+	}
+
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.selector)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q): %v", tt.selector, err)
+		}
+		if got := sel.Matches(labels); got != tt.want {
+			t.Errorf("%q.Matches(%v) = %v, want %v", tt.selector, labels, got, tt.want)
+		}
+	}
+}
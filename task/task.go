@@ -1,6 +1,7 @@
 package task
 
 import (
+	"fmt"
 	"slices"
 	"time"
 
@@ -10,42 +11,133 @@ import (
 
 type State int
 
+const DefaultNamespace = "default"
+
+// Preemption policies decide what happens to a task evicted to make room for
+// a task of higher priority or by a NoExecute taint on its node.
+const (
+	PreemptReschedule = "Reschedule"
+	PreemptFail       = "Fail"
+)
+
 const (
 	Pending State = iota
 	Scheduled
 	Running
 	Completed
 	Failed
+	Stopping
+	Restarting
+	Evicted
+	Lost
+	Cancelled
 )
 
+var stateNames = map[State]string{
+	Pending:    "Pending",
+	Scheduled:  "Scheduled",
+	Running:    "Running",
+	Completed:  "Completed",
+	Failed:     "Failed",
+	Stopping:   "Stopping",
+	Restarting: "Restarting",
+	Evicted:    "Evicted",
+	Lost:       "Lost",
+	Cancelled:  "Cancelled",
+}
+
+// Lost is not terminal: a task on a worker that stopped responding moves back
+// to whatever state the worker reports once it is reachable again. A task
+// stopped to make room for one of higher priority returns to Pending when its
+// preemption policy is to reschedule it.
 var stateTransitionMap = map[State][]State{
-	Pending:   {Scheduled, Failed},
-	Scheduled: {Scheduled, Running, Failed},
-	Running:   {Running, Completed, Failed},
-	Failed:    {},
-	Completed: {},
+	Pending:    {Scheduled, Failed, Cancelled},
+	Scheduled:  {Scheduled, Running, Stopping, Failed, Cancelled, Lost},
+	Running:    {Running, Stopping, Restarting, Completed, Failed, Evicted, Lost},
+	Stopping:   {Stopping, Pending, Completed, Failed, Lost},
+	Restarting: {Restarting, Running, Stopping, Failed, Evicted, Lost},
+	Lost:       {Running, Completed, Failed, Evicted},
+	Failed:     {},
+	Completed:  {},
+	Evicted:    {},
+	Cancelled:  {},
+}
+
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	name, ok := stateNames[s]
+	if !ok {
+		return nil, fmt.Errorf("unknown task state %d", int(s))
+	}
+	return []byte(name), nil
+}
+
+func (s *State) UnmarshalText(text []byte) error {
+	for state, name := range stateNames {
+		if name == string(text) {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown task state %q", text)
 }
 
 type Task struct {
-	ID            uuid.UUID
-	ContainerID   string
-	Name          string
-	State         State
-	Image         string
-	Memory        int
-	Disk          int
-	ExposedPorts  nat.PortSet
-	PortBindings  map[string]string
-	RestartPolicy string
-	StartTime     time.Time
-	FinishTime    time.Time
+	APIVersion       string            `json:"apiVersion"`
+	ID               uuid.UUID         `json:"id"`
+	ContainerID      string            `json:"containerId,omitempty"`
+	Name             string            `json:"name,omitempty"`
+	Namespace        string            `json:"namespace,omitempty"`
+	State            State             `json:"state"`
+	Image            string            `json:"image"`
+	ImagePullPolicy  string            `json:"imagePullPolicy,omitempty"`
+	ImagePullSecret  string            `json:"imagePullSecret,omitempty"`
+	Cmd              []string          `json:"cmd,omitempty"`
+	Entrypoint       []string          `json:"entrypoint,omitempty"`
+	Env              []string          `json:"env,omitempty"`
+	WorkingDir       string            `json:"workingDir,omitempty"`
+	User             string            `json:"user,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	CpuRequest       float64           `json:"cpuRequest,omitempty"`
+	CpuLimit         float64           `json:"cpuLimit,omitempty"`
+	Memory           int               `json:"memory,omitempty"`
+	Disk             int               `json:"disk,omitempty"`
+	ExposedPorts     nat.PortSet       `json:"exposedPorts,omitempty"`
+	PortBindings     map[string]string `json:"portBindings,omitempty"`
+	RestartPolicy    string            `json:"restartPolicy,omitempty"`
+	Priority         int               `json:"priority,omitempty"`
+	PreemptionPolicy string            `json:"preemptionPolicy,omitempty"`
+	NodeSelector     map[string]string `json:"nodeSelector,omitempty"`
+	Affinity         *Affinity         `json:"affinity,omitempty"`
+	Tolerations      []Toleration      `json:"tolerations,omitempty"`
+	PullProgress     *PullProgress     `json:"pullProgress,omitempty"`
+	Error            string            `json:"error,omitempty"`
+	StartTime        time.Time         `json:"startTime"`
+	FinishTime       time.Time         `json:"finishTime"`
+}
+
+// PullProgress reports how far the worker has got pulling the image of a
+// task that is about to start. Byte counts cover the layers being downloaded.
+type PullProgress struct {
+	Status     string `json:"status"`
+	Layers     int    `json:"layers"`
+	LayersDone int    `json:"layersDone"`
+	Current    int64  `json:"current"`
+	Total      int64  `json:"total"`
 }
 
 type TaskEvent struct {
-	ID        uuid.UUID
-	State     State
-	Timestamp time.Time
-	Task      Task
+	APIVersion string    `json:"apiVersion"`
+	ID         uuid.UUID `json:"id"`
+	State      State     `json:"state"`
+	Timestamp  time.Time `json:"timestamp"`
+	Task       Task      `json:"task"`
 }
 
 type Result struct {
@@ -58,3 +150,16 @@ type Result struct {
 func ValidStateTransition(src State, dst State) bool {
 	return slices.Contains(stateTransitionMap[src], dst)
 }
+
+func IsTerminal(s State) bool {
+	return len(stateTransitionMap[s]) == 0
+}
+
+// CpuRequested returns the number of cores the scheduler reserves for the
+// task. A task that only sets a limit is treated as requesting its limit.
+func (t *Task) CpuRequested() float64 {
+	if t.CpuRequest == 0 {
+		return t.CpuLimit
+	}
+	return t.CpuRequest
+}
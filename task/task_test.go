@@ -0,0 +1,85 @@
+package task
+
+import "testing"
+
+func TestValidStateTransition(t *testing.T) {
+	tests := []struct {
+		src  State
+		dst  State
+		want bool
+	}{
+		{Pending, Scheduled, true},
+		{Pending, Cancelled, true},
+		{Pending, Running, false},
+		{Scheduled, Running, true},
+		{Scheduled, Lost, true},
+		{Scheduled, Completed, false},
+		{Running, Evicted, true},
+		{Running, Restarting, true},
+		{Running, Pending, false},
+		{Stopping, Completed, true},
+		{Stopping, Pending, true},
+		{Stopping, Running, false},
+		{Restarting, Running, true},
+		{Lost, Running, true},
+		{Lost, Completed, true},
+		{Lost, Evicted, true},
+		{Lost, Scheduled, false},
+		{Completed, Running, false},
+		{Failed, Pending, false},
+		{Evicted, Running, false},
+		{Cancelled, Scheduled, false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidStateTransition(tt.src, tt.dst); got != tt.want {
+			t.Errorf("ValidStateTransition(%v, %v) = %v, want %v", tt.src, tt.dst, got, tt.want)
+		}
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	tests := []struct {
+		state State
+		want  bool
+	}{
+		{Pending, false},
+		{Scheduled, false},
+		{Running, false},
+		{Stopping, false},
+		{Restarting, false},
+		{Lost, false},
+		{Completed, true},
+		{Failed, true},
+		{Evicted, true},
+		{Cancelled, true},
+	}
+
+	for _, tt := range tests {
+		if got := IsTerminal(tt.state); got != tt.want {
+			t.Errorf("IsTerminal(%v) = %v, want %v", tt.state, got, tt.want)
+		}
+	}
+}
+
+func TestStateText(t *testing.T) {
+	for state, name := range stateNames {
+		text, err := state.MarshalText()
+		if err != nil || string(text) != name {
+			t.Errorf("%d.MarshalText() = %q, %v, want %q", int(state), text, err, name)
+		}
+
+		var got State
+		if err := got.UnmarshalText([]byte(name)); err != nil || got != state {
+			t.Errorf("UnmarshalText(%q) = %v, %v, want %v", name, got, err, state)
+		}
+	}
+
+	if _, err := State(99).MarshalText(); err == nil {
+		t.Error("MarshalText of an unknown state succeeded")
+	}
+	var s State
+	if err := s.UnmarshalText([]byte("Sleeping")); err == nil {
+		t.Error("UnmarshalText of an unknown state succeeded")
+	}
+}
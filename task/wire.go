@@ -0,0 +1,149 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// APIVersion identifies the JSON wire format of tasks and task events. It is
+// written on every encoded Task and TaskEvent and checked when decoding, so a
+// manager and worker speaking different versions reject each other's payloads
+// instead of misreading them.
+//
+// A TaskEvent in the cube/v1 format looks like:
+//
+//	{
+//	  "apiVersion": "cube/v1",
+//	  "id": "266592cd-960d-4091-981c-8c25c44b1018",
+//	  "state": "Pending",
+//	  "timestamp": "2024-03-01T10:00:00Z",
+//	  "task": {
+//	    "apiVersion": "cube/v1",
+//	    "id": "21b23589-5d2d-4731-b5c9-a97e9832d021",
+//	    "name": "web",
+//	    "state": "Pending",
+//	    "image": "nginx:1.25",
+//	    "env": ["PORT=8080"],
+//	    "cpuRequest": 0.5,
+//	    "memory": 67108864,
+//	    "startTime": "0001-01-01T00:00:00Z",
+//	    "finishTime": "0001-01-01T00:00:00Z"
+//	  }
+//	}
+//
+// States are encoded by name (Pending, Scheduled, Running, Completed, Failed,
+// Stopping, Restarting, Evicted, Lost, Cancelled). Unknown fields, unknown
+// states and a missing or different apiVersion are decoding errors. The task
+// nested in an event may omit its apiVersion.
+const APIVersion = "cube/v1"
+
+func (t Task) MarshalJSON() ([]byte, error) {
+	type wire Task
+	w := wire(t)
+	w.APIVersion = APIVersion
+	return json.Marshal(w)
+}
+
+func (te TaskEvent) MarshalJSON() ([]byte, error) {
+	type wire TaskEvent
+	w := wire(te)
+	w.APIVersion = APIVersion
+	return json.Marshal(w)
+}
+
+type wireResult struct {
+	Error       string `json:"error,omitempty"`
+	Action      string `json:"action,omitempty"`
+	ContainerId string `json:"containerId,omitempty"`
+	Result      string `json:"result,omitempty"`
+}
+
+func (r Result) MarshalJSON() ([]byte, error) {
+	w := wireResult{
+		Action:      r.Action,
+		ContainerId: r.ContainerId,
+		Result:      r.Result,
+	}
+	if r.Error != nil {
+		w.Error = r.Error.Error()
+	}
+	return json.Marshal(w)
+}
+
+func (r *Result) UnmarshalJSON(data []byte) error {
+	var w wireResult
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+
+	*r = Result{
+		Action:      w.Action,
+		ContainerId: w.ContainerId,
+		Result:      w.Result,
+	}
+	if w.Error != "" {
+		r.Error = errors.New(w.Error)
+	}
+	return nil
+}
+
+func DecodeTaskEvent(r io.Reader) (TaskEvent, error) {
+	var te TaskEvent
+	if err := newDecoder(r).Decode(&te); err != nil {
+		return TaskEvent{}, err
+	}
+
+	if err := checkVersion(te.APIVersion); err != nil {
+		return TaskEvent{}, err
+	}
+	if te.Task.APIVersion != "" {
+		if err := checkVersion(te.Task.APIVersion); err != nil {
+			return TaskEvent{}, fmt.Errorf("task: %w", err)
+		}
+	}
+	return te, nil
+}
+
+func DecodeTask(r io.Reader) (Task, error) {
+	var t Task
+	if err := newDecoder(r).Decode(&t); err != nil {
+		return Task{}, err
+	}
+
+	if err := checkVersion(t.APIVersion); err != nil {
+		return Task{}, err
+	}
+	return t, nil
+}
+
+func DecodeTasks(r io.Reader) ([]*Task, error) {
+	var tasks []*Task
+	if err := newDecoder(r).Decode(&tasks); err != nil {
+		return nil, err
+	}
+
+	for _, t := range tasks {
+		if err := checkVersion(t.APIVersion); err != nil {
+			return nil, fmt.Errorf("task %v: %w", t.ID, err)
+		}
+	}
+	return tasks, nil
+}
+
+func newDecoder(r io.Reader) *json.Decoder {
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	return d
+}
+
+func checkVersion(v string) error {
+	if v == "" {
+		return fmt.Errorf("missing apiVersion, expected %q", APIVersion)
+	}
+	if v != APIVersion {
+		return fmt.Errorf("unsupported apiVersion %q, expected %q", v, APIVersion)
+	}
+	return nil
+}
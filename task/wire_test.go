@@ -0,0 +1,130 @@
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestTaskEventRoundTrip(t *testing.T) {
+	te := TaskEvent{
+		ID:    uuid.New(),
+		State: Pending,
+		Task: Task{
+			ID:    uuid.New(),
+			Name:  "web",
+			State: Pending,
+			Image: "nginx:1.25",
+		},
+	}
+
+	data, err := json.Marshal(te)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !bytes.Contains(data, []byte(`"state":"Pending"`)) {
+		t.Errorf("state is not encoded by name: %s", data)
+	}
+
+	got, err := DecodeTaskEvent(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeTaskEvent: %v", err)
+	}
+	if got.APIVersion != APIVersion || got.Task.APIVersion != APIVersion {
+		t.Errorf("apiVersion = %q, %q, want %q", got.APIVersion, got.Task.APIVersion, APIVersion)
+	}
+	if got.ID != te.ID || got.Task.ID != te.Task.ID || got.Task.Image != te.Task.Image {
+		t.Errorf("decoded %+v, want %+v", got, te)
+	}
+}
+
+func TestDecodeTaskEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			body: `{"apiVersion":"cube/v1","state":"Pending","task":{"apiVersion":"cube/v1","state":"Pending","image":"nginx"}}`,
+		},
+		{
+			name: "task without apiVersion",
+			body: `{"apiVersion":"cube/v1","state":"Pending","task":{"state":"Pending","image":"nginx"}}`,
+		},
+		{
+			name:    "missing apiVersion",
+			body:    `{"state":"Pending","task":{"state":"Pending"}}`,
+			wantErr: "missing apiVersion",
+		},
+		{
+			name:    "other apiVersion",
+			body:    `{"apiVersion":"cube/v2","state":"Pending","task":{"state":"Pending"}}`,
+			wantErr: "unsupported apiVersion",
+		},
+		{
+			name:    "other task apiVersion",
+			body:    `{"apiVersion":"cube/v1","state":"Pending","task":{"apiVersion":"cube/v0","state":"Pending"}}`,
+			wantErr: "task: unsupported apiVersion",
+		},
+		{
+			name:    "unknown field",
+			body:    `{"apiVersion":"cube/v1","state":"Pending","task":{"state":"Pending","replicas":3}}`,
+			wantErr: "unknown field",
+		},
+		{
+			name:    "unknown state",
+			body:    `{"apiVersion":"cube/v1","state":"Sleeping","task":{"state":"Pending"}}`,
+			wantErr: "unknown task state",
+		},
+		{
+			name:    "numeric state",
+			body:    `{"apiVersion":"cube/v1","state":0,"task":{"state":"Pending"}}`,
+			wantErr: "cannot unmarshal",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeTaskEvent(strings.NewReader(tt.body))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("DecodeTaskEvent: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("DecodeTaskEvent error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecodeTasks(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    int
+		wantErr bool
+	}{
+		{name: "empty", body: `[]`},
+		{name: "valid", body: `[{"apiVersion":"cube/v1","state":"Running"},{"apiVersion":"cube/v1","state":"Lost"}]`, want: 2},
+		{name: "one without apiVersion", body: `[{"apiVersion":"cube/v1","state":"Running"},{"state":"Running"}]`, wantErr: true},
+		{name: "unknown field", body: `[{"apiVersion":"cube/v1","state":"Running","node":"w1"}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks, err := DecodeTasks(strings.NewReader(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeTasks error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(tasks) != tt.want {
+				t.Errorf("DecodeTasks returned %d tasks, want %d", len(tasks), tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package worker
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -8,6 +10,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/auth"
 	"github.com/reversearrow/orchestrator/task"
 )
 
@@ -17,6 +20,9 @@ type Api struct {
 	Worker  *Worker
 	Router  *chi.Mux
 	Logger  *log.Logger
+
+	Auth      *auth.Authenticator
+	TLSConfig *tls.Config
 }
 
 func NewAPI(address string, port int, worker *Worker, logger *log.Logger) (*Api, error) {
@@ -56,11 +62,8 @@ type ErrorResponse struct {
 }
 
 func (a *Api) StartTask(w http.ResponseWriter, r *http.Request) {
-	d := json.NewDecoder(r.Body)
-	d.DisallowUnknownFields()
-
-	te := task.TaskEvent{}
-	if err := d.Decode(&te); err != nil {
+	te, err := task.DecodeTaskEvent(r.Body)
+	if err != nil {
 		msg := fmt.Sprintf("error marshalling body: %v\n", err)
 		log.Println(msg)
 		w.WriteHeader(http.StatusBadRequest)
@@ -73,6 +76,7 @@ func (a *Api) StartTask(w http.ResponseWriter, r *http.Request) {
 
 	a.Worker.AddTask(r.Context(), te.Task)
 	a.Logger.Printf("added task: %v\n", te.Task.ID)
+	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(te.Task); err != nil {
 		log.Printf("error encoding task: %v\n", err)
 		return
@@ -100,40 +104,166 @@ func (a *Api) StopTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, ok := a.Worker.Db[tID]
+	taskToStop, ok := a.Worker.GetTask(tID)
 	if !ok {
 		a.Logger.Printf("task with id: %v not found", tID)
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	taskToStop := a.Worker.Db[tID]
-	taskCopy := *taskToStop
-	taskCopy.State = task.Completed
+	taskCopy := taskToStop
+	taskCopy.State = task.Stopping
 	a.Worker.AddTask(r.Context(), taskCopy)
 	a.Logger.Printf("added task :%v to stop container: %v\n", taskToStop.ID, taskToStop.ContainerID)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (a *Api) UpdateTask(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(chi.URLParam(r, "taskID"))
+	if err != nil {
+		a.Logger.Printf("failed to parse task id from the request: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	te, err := task.DecodeTaskEvent(r.Body)
+	if err != nil {
+		msg := fmt.Sprintf("error marshalling body: %v\n", err)
+		a.Logger.Println(msg)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			HTTPStatusCode: http.StatusBadRequest,
+			Message:        msg,
+		})
+		return
+	}
+
+	if te.Task.ID != tID || (te.Task.State != task.Running && te.Task.State != task.Restarting) {
+		msg := fmt.Sprintf("invalid update for task %v", tID)
+		a.Logger.Println(msg)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			HTTPStatusCode: http.StatusBadRequest,
+			Message:        msg,
+		})
+		return
+	}
+
+	persisted, ok := a.Worker.GetTask(tID)
+	if !ok {
+		a.Logger.Printf("task with id: %v not found", tID)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !task.ValidStateTransition(persisted.State, te.Task.State) {
+		msg := fmt.Sprintf("task %v is %v and cannot be updated", tID, persisted.State)
+		a.Logger.Println(msg)
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			HTTPStatusCode: http.StatusConflict,
+			Message:        msg,
+		})
+		return
+	}
+
+	// The update is applied before answering, so that the manager can roll
+	// its copy of the task back if the runtime refuses it. A replace only
+	// waits for the old container to stop; the new one starts in the
+	// background.
+	var result task.Result
+	if te.Task.State == task.Running {
+		result = a.Worker.UpdateTask(r.Context(), te.Task)
+	} else {
+		result = a.Worker.ReplaceTask(r.Context(), te.Task)
+	}
+	if result.Error != nil {
+		msg := fmt.Sprintf("error updating task %v: %v", tID, result.Error)
+		a.Logger.Println(msg)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			HTTPStatusCode: http.StatusInternalServerError,
+			Message:        msg,
+		})
+		return
+	}
+
+	a.Logger.Printf("updated task %v to %v\n", tID, te.Task.State)
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (a *Api) GetStatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(a.Worker.Stats)
 }
 
+type PrePullRequest struct {
+	Images []string
+}
+
+func (a *Api) PrePullImages(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	req := PrePullRequest{}
+	if err := d.Decode(&req); err != nil {
+		msg := fmt.Sprintf("error marshalling body: %v\n", err)
+		a.Logger.Println(msg)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			HTTPStatusCode: http.StatusBadRequest,
+			Message:        msg,
+		})
+		return
+	}
+
+	go a.Worker.PrePullImages(context.Background(), req.Images)
+	a.Logger.Printf("pre-pulling images: %v\n", req.Images)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *Api) GetImages(w http.ResponseWriter, r *http.Request) {
+	images, err := a.Worker.GetImages(r.Context())
+	if err != nil {
+		msg := fmt.Sprintf("error listing images: %v", err)
+		a.Logger.Println(msg)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			HTTPStatusCode: http.StatusInternalServerError,
+			Message:        msg,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(images)
+}
+
 func (a *Api) initRouter() {
 	a.Router = chi.NewRouter()
+	if a.Auth != nil {
+		// Only the manager drives a worker; other workers and clients that
+		// share the CA or hold a token are refused.
+		a.Router.Use(a.Auth.Middleware, a.Auth.RequireGroup(auth.GroupManagers))
+	}
 	a.Router.Route("/tasks", func(r chi.Router) {
 		r.Post("/", a.StartTask)
 		r.Get("/", a.GetTasks)
 		r.Route("/{taskID}", func(r chi.Router) {
 			r.Delete("/", a.StopTask)
+			r.Patch("/", a.UpdateTask)
 		})
 	})
 
 	a.Router.Route("/stats", func(r chi.Router) {
 		r.Get("/", a.GetStatsHandler)
 	})
+
+	a.Router.Route("/images", func(r chi.Router) {
+		r.Post("/", a.PrePullImages)
+		r.Get("/", a.GetImages)
+	})
 }
 
 func (a *Api) Start() {
@@ -141,7 +271,19 @@ func (a *Api) Start() {
 	a.Logger.Printf("attempting to start the worker: %s:%d\n", a.Address, a.Port)
 
 	go func() {
-		if err := http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router); err != nil {
+		srv := &http.Server{
+			Addr:      fmt.Sprintf("%s:%d", a.Address, a.Port),
+			Handler:   a.Router,
+			TLSConfig: a.TLSConfig,
+		}
+
+		var err error
+		if a.TLSConfig != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
 			a.Logger.Printf("failed to start the worker api: %v", err)
 		}
 	}()
@@ -0,0 +1,121 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/reversearrow/orchestrator/container/docker"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+const (
+	defaultImageGCHighThreshold = 0.85
+	defaultImageGCLowThreshold  = 0.80
+)
+
+func (w *Worker) PrePullImages(ctx context.Context, images []string) {
+	for _, image := range images {
+		auth, err := w.registryAuth(task.Task{Image: image})
+		if err != nil {
+			w.Logger.Printf("error resolving registry credentials for %s: %v\n", image, err)
+			continue
+		}
+
+		d, err := docker.NewDocker(&docker.Config{
+			Image:        image,
+			PullPolicy:   docker.PullIfNotPresent,
+			RegistryAuth: auth,
+		})
+		if err != nil {
+			w.Logger.Printf("error creating a new docker instance: %v\n", err)
+			continue
+		}
+
+		if err := d.PullImage(ctx); err != nil {
+			w.Logger.Printf("error pre-pulling image %s: %v\n", image, err)
+			continue
+		}
+		w.Logger.Printf("pre-pulled image %s\n", image)
+	}
+}
+
+func (w *Worker) GetImages(ctx context.Context) ([]string, error) {
+	d, err := docker.NewDocker(&docker.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("error creating a new docker instance: %w", err)
+	}
+
+	images, err := d.ListImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	for _, i := range images {
+		tags = append(tags, i.Tags...)
+	}
+	return tags, nil
+}
+
+func (w *Worker) CollectImages(ctx context.Context) {
+	for {
+		w.Logger.Println("checking disk usage for image garbage collection")
+		w.collectImages(ctx)
+		time.Sleep(time.Minute * 5)
+	}
+}
+
+// collectImages removes unused images, oldest first, once disk usage crosses
+// the high threshold and until it drops below the low threshold.
+func (w *Worker) collectImages(ctx context.Context) {
+	high, low := w.ImageGCHighThreshold, w.ImageGCLowThreshold
+	if high == 0 {
+		high = defaultImageGCHighThreshold
+	}
+	if low == 0 {
+		low = defaultImageGCLowThreshold
+	}
+
+	disk := GetDiskInfo(w.Logger)
+	if disk.All == 0 {
+		return
+	}
+	used := disk.Used
+	if float64(used)/float64(disk.All) < high {
+		return
+	}
+
+	d, err := docker.NewDocker(&docker.Config{})
+	if err != nil {
+		w.Logger.Printf("error creating a new docker instance: %v\n", err)
+		return
+	}
+
+	images, err := d.ListImages(ctx)
+	if err != nil {
+		w.Logger.Printf("error listing images for garbage collection: %v\n", err)
+		return
+	}
+
+	target := uint64(low * float64(disk.All))
+	for _, i := range images {
+		if used <= target {
+			return
+		}
+		if i.InUse {
+			continue
+		}
+
+		if err := d.RemoveImage(ctx, i.ID); err != nil {
+			w.Logger.Printf("error collecting image %s: %v\n", i.ID, err)
+			continue
+		}
+		w.Logger.Printf("collected unused image %s %v, freed %d bytes\n", i.ID, i.Tags, i.Size)
+		if uint64(i.Size) > used {
+			used = 0
+			continue
+		}
+		used -= uint64(i.Size)
+	}
+}
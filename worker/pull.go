@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/container/docker"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+const pullProgressInterval = time.Second
+
+type layerProgress struct {
+	current int64
+	total   int64
+	done    bool
+}
+
+// pullTracker sums the progress of the layers of an image being pulled.
+type pullTracker struct {
+	layers map[string]*layerProgress
+	last   time.Time
+}
+
+// update records p and reports whether the progress should be published,
+// which is at most once per interval unless a layer has finished.
+func (pt *pullTracker) update(p docker.PullProgress) bool {
+	if p.Layer == "" {
+		return false
+	}
+	if pt.layers == nil {
+		pt.layers = make(map[string]*layerProgress)
+	}
+	l, ok := pt.layers[p.Layer]
+	if !ok {
+		l = &layerProgress{}
+		pt.layers[p.Layer] = l
+	}
+
+	switch p.Status {
+	case "Downloading":
+		l.current, l.total = p.Current, p.Total
+	case "Download complete", "Pull complete", "Already exists":
+		if l.total > 0 {
+			l.current = l.total
+		}
+		finished := !l.done
+		l.done = true
+		if finished {
+			pt.last = time.Now()
+		}
+		return finished
+	}
+
+	if time.Since(pt.last) < pullProgressInterval {
+		return false
+	}
+	pt.last = time.Now()
+	return true
+}
+
+func (pt *pullTracker) progress(status string) task.PullProgress {
+	p := task.PullProgress{Status: status, Layers: len(pt.layers)}
+	for _, l := range pt.layers {
+		p.Current += l.current
+		p.Total += l.total
+		if l.done {
+			p.LayersDone++
+		}
+	}
+	return p
+}
+
+// setPullProgress stores the pull progress of a task whose container is not
+// running yet and reports it to the manager.
+func (w *Worker) setPullProgress(id uuid.UUID, p task.PullProgress) {
+	w.mu.Lock()
+	stored, ok := w.Db[id]
+	if !ok || (stored.State != task.Scheduled && stored.State != task.Restarting) {
+		w.mu.Unlock()
+		return
+	}
+	tc := *stored
+	tc.PullProgress = &p
+	w.Db[id] = &tc
+	w.mu.Unlock()
+
+	w.report(&tc)
+}
@@ -0,0 +1,171 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	url2 "net/url"
+	"time"
+
+	"github.com/reversearrow/orchestrator/auth"
+	"github.com/reversearrow/orchestrator/node"
+)
+
+const registrationCheckInterval = time.Hour
+
+// Registration registers the worker with the manager. With CertFile and
+// KeyFile set, the worker also asks the manager's CA for a certificate and
+// renews it before it expires.
+type Registration struct {
+	ManagerAddress string
+	Scheme         string
+	Name           string
+	Labels         map[string]string
+	Taints         []node.Taint
+	CertFile       string
+	KeyFile        string
+	Logger         *log.Logger
+	client         *http.Client
+}
+
+type registerRequest struct {
+	Name   string
+	CSR    string
+	Labels map[string]string
+	Taints []node.Taint
+}
+
+type registerResponse struct {
+	Name        string
+	Certificate string
+	CA          string
+}
+
+func NewRegistration(l *log.Logger, c *http.Client, managerAddress string, name string) (*Registration, error) {
+	r := &Registration{
+		ManagerAddress: managerAddress,
+		Scheme:         "http",
+		Name:           name,
+		Logger:         l,
+		client:         c,
+	}
+
+	return r, r.validate()
+}
+
+func (r *Registration) validate() error {
+	if r.ManagerAddress == "" {
+		return fmt.Errorf("registration: manager address is empty")
+	}
+
+	if r.Name == "" {
+		return fmt.Errorf("registration: worker name is empty")
+	}
+
+	if r.Logger == nil {
+		return fmt.Errorf("registration: logger is nil")
+	}
+
+	if r.client == nil {
+		return fmt.Errorf("registration: http client is nil")
+	}
+
+	return nil
+}
+
+func (r *Registration) Register() error {
+	req := registerRequest{Name: r.Name, Labels: r.Labels, Taints: r.Taints}
+
+	var keyPEM []byte
+	if r.CertFile != "" {
+		csr, key, err := auth.NewCSR(r.Name, nil)
+		if err != nil {
+			return fmt.Errorf("error creating certificate request: %w", err)
+		}
+		req.CSR = string(csr)
+		keyPEM = key
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	u := url2.URL{
+		Scheme: r.Scheme,
+		Host:   r.ManagerAddress,
+		Path:   "nodes",
+	}
+	resp, err := r.client.Post(u.String(), "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error registering with the manager: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("error registering with the manager, resp code: %d", resp.StatusCode)
+	}
+
+	var rr registerResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rr); err != nil {
+		return fmt.Errorf("error decoding registration response: %w", err)
+	}
+
+	if r.CertFile == "" {
+		r.Logger.Printf("registered with the manager as %s\n", r.Name)
+		return nil
+	}
+	if rr.Certificate == "" {
+		return fmt.Errorf("manager did not issue a certificate, is its ca configured?")
+	}
+
+	if err := auth.WriteKeyPair(r.CertFile, r.KeyFile, []byte(rr.Certificate), keyPEM); err != nil {
+		return err
+	}
+	r.Logger.Printf("registered with the manager as %s and received a certificate\n", r.Name)
+	return nil
+}
+
+// RegisterWithRetry registers with the manager, retrying with exponential
+// backoff while the manager is not reachable yet.
+func (r *Registration) RegisterWithRetry(attempts int) error {
+	backoff := time.Second
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = r.Register(); err == nil {
+			return nil
+		}
+		r.Logger.Printf("attempt %d to register with the manager failed: %v\n", i+1, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return err
+}
+
+// Run renews the worker's certificate once it is due for renewal.
+func (r *Registration) Run(ctx context.Context) {
+	if r.CertFile == "" {
+		return
+	}
+
+	ticker := time.NewTicker(registrationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !auth.NeedsRenewal(r.CertFile) {
+			continue
+		}
+		if err := r.Register(); err != nil {
+			r.Logger.Printf("error renewing the worker certificate: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/docker/docker/api/types/registry"
+	"github.com/reversearrow/orchestrator/container/docker"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+type RegistryCredential struct {
+	Name          string
+	Server        string
+	Username      string
+	Password      string
+	IdentityToken string
+}
+
+func LoadRegistryCredentials(path string) ([]RegistryCredential, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading registry credentials: %w", err)
+	}
+
+	var creds []RegistryCredential
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("error decoding registry credentials: %w", err)
+	}
+
+	for _, c := range creds {
+		if c.Name == "" || c.Server == "" {
+			return nil, fmt.Errorf("registry credential must have a name and a server")
+		}
+	}
+
+	return creds, nil
+}
+
+// registryAuth returns the encoded credentials used to pull the task's image.
+// A task can name a credential explicitly with ImagePullSecret, otherwise the
+// credential configured for the image's registry is used, if any.
+func (w *Worker) registryAuth(t task.Task) (string, error) {
+	var cred *RegistryCredential
+	if t.ImagePullSecret != "" {
+		for i := range w.Registries {
+			if w.Registries[i].Name == t.ImagePullSecret {
+				cred = &w.Registries[i]
+				break
+			}
+		}
+		if cred == nil {
+			return "", fmt.Errorf("registry credential %q not configured on worker", t.ImagePullSecret)
+		}
+	} else {
+		domain, err := docker.RegistryDomain(t.Image)
+		if err != nil {
+			return "", err
+		}
+		for i := range w.Registries {
+			if w.Registries[i].Server == domain {
+				cred = &w.Registries[i]
+				break
+			}
+		}
+	}
+
+	if cred == nil {
+		return "", nil
+	}
+
+	return registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      cred.Username,
+		Password:      cred.Password,
+		IdentityToken: cred.IdentityToken,
+		ServerAddress: cred.Server,
+	})
+}
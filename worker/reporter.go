@@ -0,0 +1,173 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	url2 "net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/reversearrow/orchestrator/task"
+)
+
+const (
+	defaultReportBatchSize     = 100
+	defaultReportFlushInterval = time.Second
+	defaultReportMaxRetries    = 5
+	defaultReportBuffer        = 1024
+)
+
+// Reporter pushes task state changes from the worker to the manager. Updates
+// are batched, with only the latest update per task kept, and retried with
+// exponential backoff. Updates that cannot be delivered are dropped; the
+// manager's periodic resync picks them up.
+type Reporter struct {
+	ManagerAddress string
+	Scheme         string
+	Worker         string
+	BatchSize      int
+	FlushInterval  time.Duration
+	MaxRetries     int
+	Logger         *log.Logger
+	client         *http.Client
+	updates        chan task.Task
+}
+
+func NewReporter(l *log.Logger, c *http.Client, managerAddress string, worker string) (*Reporter, error) {
+	r := &Reporter{
+		ManagerAddress: managerAddress,
+		Scheme:         "http",
+		Worker:         worker,
+		BatchSize:      defaultReportBatchSize,
+		FlushInterval:  defaultReportFlushInterval,
+		MaxRetries:     defaultReportMaxRetries,
+		Logger:         l,
+		client:         c,
+		updates:        make(chan task.Task, defaultReportBuffer),
+	}
+
+	return r, r.validate()
+}
+
+func (r *Reporter) validate() error {
+	if r.ManagerAddress == "" {
+		return fmt.Errorf("reporter: manager address is empty")
+	}
+
+	if r.Worker == "" {
+		return fmt.Errorf("reporter: worker name is empty")
+	}
+
+	if r.Logger == nil {
+		return fmt.Errorf("reporter: logger is nil")
+	}
+
+	if r.client == nil {
+		return fmt.Errorf("reporter: http client is nil")
+	}
+
+	return nil
+}
+
+func (r *Reporter) Report(t task.Task) {
+	select {
+	case r.updates <- t:
+	default:
+		r.Logger.Printf("report buffer full, dropping update for task %v\n", t.ID)
+	}
+}
+
+func (r *Reporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make(map[uuid.UUID]task.Task)
+	for {
+		select {
+		case <-ctx.Done():
+			r.flush(context.Background(), batch)
+			return
+		case t := <-r.updates:
+			batch[t.ID] = t
+			if len(batch) < r.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		r.flush(ctx, batch)
+		batch = make(map[uuid.UUID]task.Task)
+	}
+}
+
+func (r *Reporter) flush(ctx context.Context, batch map[uuid.UUID]task.Task) {
+	if len(batch) == 0 {
+		return
+	}
+
+	tasks := make([]task.Task, 0, len(batch))
+	for _, t := range batch {
+		tasks = append(tasks, t)
+	}
+	data, err := json.Marshal(tasks)
+	if err != nil {
+		r.Logger.Printf("error marshalling task updates: %v\n", err)
+		return
+	}
+
+	backoff := 500 * time.Millisecond
+	for attempt := 0; attempt <= r.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		err = r.send(ctx, data)
+		if err == nil {
+			return
+		}
+		r.Logger.Printf("error reporting %d task updates (attempt %d): %v\n", len(tasks), attempt+1, err)
+	}
+
+	r.Logger.Printf("giving up reporting %d task updates, leaving them to the manager's resync\n", len(tasks))
+}
+
+func (r *Reporter) send(ctx context.Context, data []byte) error {
+	u := url2.URL{
+		Scheme: r.Scheme,
+		Host:   r.ManagerAddress,
+		Path:   fmt.Sprintf("nodes/%s/tasks", r.Worker),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		e := ErrorResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(&e); err == nil && e.Message != "" {
+			return fmt.Errorf("response error (%d): %s", resp.StatusCode, e.Message)
+		}
+		return fmt.Errorf("unexpected response code %d", resp.StatusCode)
+	}
+	return nil
+}
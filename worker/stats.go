@@ -2,6 +2,7 @@ package worker
 
 import (
 	"log"
+	"runtime"
 
 	"github.com/c9s/goprocinfo/linux"
 )
@@ -11,6 +12,7 @@ type Stats struct {
 	DiskStats *linux.Disk
 	CpuStats  *linux.CPUStat
 	LoadStats *linux.LoadAvg
+	CpuCount  int
 	TaskCount int
 }
 
@@ -20,6 +22,7 @@ func GetStats(l *log.Logger) *Stats {
 		DiskStats: GetDiskInfo(l),
 		CpuStats:  GetCpuStats(l),
 		LoadStats: GetLoadAvg(l),
+		CpuCount:  runtime.NumCPU(),
 	}
 }
 
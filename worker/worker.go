@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/golang-collections/collections/queue"
@@ -14,12 +15,21 @@ import (
 )
 
 type Worker struct {
-	Name      string
-	Queue     queue.Queue
-	Db        map[uuid.UUID]*task.Task
-	TaskCount int
-	Logger    *log.Logger
-	Stats     *Stats
+	Name       string
+	Queue      queue.Queue
+	Db         map[uuid.UUID]*task.Task
+	TaskCount  int
+	Logger     *log.Logger
+	Stats      *Stats
+	Registries []RegistryCredential
+	Reporter   *Reporter
+
+	ImageGCHighThreshold float64
+	ImageGCLowThreshold  float64
+
+	// mu guards Db. Tasks in Db are never modified in place; updates store a
+	// new copy.
+	mu sync.RWMutex
 }
 
 func NewWorker(logger *log.Logger, queue *queue.Queue, db map[uuid.UUID]*task.Task) (*Worker, error) {
@@ -65,10 +75,13 @@ func (w *Worker) runTask(ctx context.Context) task.Result {
 	}
 
 	taskQueued := t.(task.Task)
-	taskPersisted := w.Db[taskQueued.ID]
-	if taskPersisted == nil {
-		taskPersisted = &taskQueued
+	taskPersisted, ok := w.GetTask(taskQueued.ID)
+	// A task the manager rescheduled after it finished here starts over.
+	if !ok || (task.IsTerminal(taskPersisted.State) && taskQueued.State == task.Scheduled) {
+		taskPersisted = taskQueued
+		w.mu.Lock()
 		w.Db[taskQueued.ID] = &taskQueued
+		w.mu.Unlock()
 	}
 
 	var result task.Result
@@ -76,8 +89,11 @@ func (w *Worker) runTask(ctx context.Context) task.Result {
 		switch taskQueued.State {
 		case task.Scheduled:
 			result = w.StartTask(ctx, taskQueued)
-		case task.Completed:
+		case task.Stopping:
 			result = w.StopTask(ctx, taskQueued)
+		case task.Restarting:
+			// ReplaceTask has stopped the old container.
+			result = w.StartTask(ctx, taskQueued)
 		default:
 			result.Error = errors.New("we should not get here")
 		}
@@ -91,6 +107,23 @@ func (w *Worker) runTask(ctx context.Context) task.Result {
 func (w *Worker) StartTask(ctx context.Context, t task.Task) task.Result {
 	t.StartTime = time.Now().UTC()
 	cfg := docker.NewConfig(&t)
+	auth, err := w.registryAuth(t)
+	if err != nil {
+		err = fmt.Errorf("error resolving registry credentials: %w", err)
+		t.State = task.Failed
+		t.Error = err.Error()
+		w.saveTask(&t)
+		return task.Result{
+			Error: err,
+		}
+	}
+	cfg.RegistryAuth = auth
+	var pulls pullTracker
+	cfg.OnPullProgress = func(p docker.PullProgress) {
+		if pulls.update(p) {
+			w.setPullProgress(t.ID, pulls.progress(p.Status))
+		}
+	}
 	d, err := docker.NewDocker(cfg)
 	if err != nil {
 		return task.Result{
@@ -101,12 +134,13 @@ func (w *Worker) StartTask(ctx context.Context, t task.Task) task.Result {
 	if result.Error != nil {
 		w.Logger.Printf("error starting the task: %v", result.Error)
 		t.State = task.Failed
-		w.Db[t.ID] = &t
+		t.Error = result.Error.Error()
+		w.saveTask(&t)
 		return result
 	}
 	t.ContainerID = result.ContainerId
 	t.State = task.Running
-	w.Db[t.ID] = &t
+	w.saveTask(&t)
 	return result
 }
 
@@ -125,15 +159,212 @@ func (w *Worker) StopTask(ctx context.Context, t task.Task) task.Result {
 	}
 	t.FinishTime = time.Now().UTC()
 	t.State = task.Completed
-	w.Db[t.ID] = &t
+	w.saveTask(&t)
 	w.Logger.Printf("stopped and removed container %v for task %v\n", t.ContainerID, t.ID)
 	return result
 }
 
+// UpdateTask applies resource and restart policy changes to the task's
+// running container in place. The stored task only changes if the runtime
+// accepts the update.
+func (w *Worker) UpdateTask(ctx context.Context, t task.Task) task.Result {
+	d, err := docker.NewDocker(docker.NewConfig(&t))
+	if err != nil {
+		return task.Result{
+			Error: fmt.Errorf("error creating a new docker instance: %w", err),
+		}
+	}
+
+	result := d.Update(ctx, t.ContainerID)
+	if result.Error != nil {
+		return result
+	}
+	if !w.saveTaskIf(&t, task.Running) {
+		return task.Result{
+			Error: fmt.Errorf("task %v changed state while it was being updated", t.ID),
+		}
+	}
+	w.Logger.Printf("updated container %v for task %v in place\n", t.ContainerID, t.ID)
+	return result
+}
+
+// ReplaceTask stops the task's container and queues the task to start again
+// from its updated spec, keeping the task's ID. If the old container cannot
+// be stopped the task is left as it was.
+func (w *Worker) ReplaceTask(ctx context.Context, t task.Task) task.Result {
+	persisted, ok := w.GetTask(t.ID)
+	if !ok {
+		return task.Result{
+			Error: fmt.Errorf("task %v not found", t.ID),
+		}
+	}
+
+	d, err := docker.NewDocker(docker.NewConfig(&persisted))
+	if err != nil {
+		return task.Result{
+			Error: fmt.Errorf("error creating a new docker instance: %w", err),
+		}
+	}
+
+	result := d.Stop(ctx, persisted.ContainerID)
+	if result.Error != nil {
+		return result
+	}
+	w.Logger.Printf("stopped container %v to replace task %v\n", persisted.ContainerID, t.ID)
+
+	t.ContainerID = ""
+	t.State = task.Restarting
+	w.saveTask(&t)
+	w.AddTask(ctx, t)
+	return result
+}
+
+func (w *Worker) EnforceDiskQuotas(ctx context.Context) {
+	for {
+		w.Logger.Println("checking disk usage of running tasks")
+		w.enforceDiskQuotas(ctx)
+		time.Sleep(time.Second * 30)
+	}
+}
+
+func (w *Worker) enforceDiskQuotas(ctx context.Context) {
+	for _, t := range w.GetTasks() {
+		if t.State != task.Running || t.Disk <= 0 || t.ContainerID == "" {
+			continue
+		}
+
+		cfg := docker.NewConfig(t)
+		d, err := docker.NewDocker(cfg)
+		if err != nil {
+			w.Logger.Printf("error creating a new docker instance: %v\n", err)
+			continue
+		}
+
+		used, err := d.DiskUsage(ctx, t.ContainerID)
+		if err != nil {
+			w.Logger.Printf("error reading disk usage for task %v: %v\n", t.ID, err)
+			continue
+		}
+		if used <= int64(t.Disk) {
+			continue
+		}
+
+		w.Logger.Printf("task %v uses %d bytes of disk, exceeding its quota of %d bytes, evicting\n", t.ID, used, t.Disk)
+		result := d.Stop(ctx, t.ContainerID)
+		if result.Error != nil {
+			w.Logger.Printf("error evicting task %v: %v\n", t.ID, result.Error)
+			continue
+		}
+		t.FinishTime = time.Now().UTC()
+		t.State = task.Evicted
+		t.Error = fmt.Sprintf("disk usage of %d bytes exceeded quota of %d bytes", used, t.Disk)
+		w.saveTaskIf(t, task.Running)
+	}
+}
+
+func (w *Worker) InspectTasks(ctx context.Context) {
+	for {
+		w.Logger.Println("checking container state of running tasks")
+		w.inspectTasks(ctx)
+		time.Sleep(time.Second * 15)
+	}
+}
+
+func (w *Worker) inspectTasks(ctx context.Context) {
+	for _, t := range w.GetTasks() {
+		// A replaced task has no container until its new one has started.
+		if (t.State != task.Running && t.State != task.Restarting) || t.ContainerID == "" {
+			continue
+		}
+
+		d, err := docker.NewDocker(docker.NewConfig(t))
+		if err != nil {
+			w.Logger.Printf("error creating a new docker instance: %v\n", err)
+			continue
+		}
+
+		prev := t.State
+		state, err := d.Inspect(ctx, t.ContainerID)
+		if err != nil {
+			w.Logger.Printf("error inspecting task %v: %v\n", t.ID, err)
+			t.FinishTime = time.Now().UTC()
+			t.State = task.Failed
+			t.Error = err.Error()
+			w.saveTaskIf(t, prev)
+			continue
+		}
+
+		switch state.Status {
+		case "running":
+			t.State = task.Running
+		case "restarting":
+			t.State = task.Restarting
+		case "exited", "dead":
+			t.FinishTime = time.Now().UTC()
+			t.State = task.Completed
+			if state.ExitCode != 0 {
+				t.State = task.Failed
+				t.Error = fmt.Sprintf("container exited with code %d", state.ExitCode)
+			}
+		}
+		if t.State != prev {
+			w.saveTaskIf(t, prev)
+		}
+	}
+}
+
+func (w *Worker) saveTask(t *task.Task) {
+	tc := *t
+	w.mu.Lock()
+	w.Db[t.ID] = &tc
+	w.mu.Unlock()
+	w.report(t)
+}
+
+// saveTaskIf saves t only if the stored task is still in state prev, so that
+// a check working from an older copy does not overwrite a newer state.
+func (w *Worker) saveTaskIf(t *task.Task, prev task.State) bool {
+	tc := *t
+	w.mu.Lock()
+	stored, ok := w.Db[t.ID]
+	if !ok || stored.State != prev {
+		w.mu.Unlock()
+		return false
+	}
+	w.Db[t.ID] = &tc
+	w.mu.Unlock()
+	w.report(t)
+	return true
+}
+
+// GetTask returns a copy of the task with the given ID.
+func (w *Worker) GetTask(id uuid.UUID) (task.Task, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	t, ok := w.Db[id]
+	if !ok {
+		return task.Task{}, false
+	}
+	return *t, true
+}
+
+func (w *Worker) report(t *task.Task) {
+	if w.Reporter == nil {
+		return
+	}
+	w.Reporter.Report(*t)
+}
+
+// GetTasks returns copies of the worker's tasks.
 func (w *Worker) GetTasks() []*task.Task {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
 	tasks := make([]*task.Task, 0, len(w.Db))
-	for _, t := range tasks {
-		tasks = append(tasks, t)
+	for _, t := range w.Db {
+		tc := *t
+		tasks = append(tasks, &tc)
 	}
 	return tasks
 }